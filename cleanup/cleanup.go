@@ -2,179 +2,348 @@ package cleanup
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"regexp"
 	"sort"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/gkwa/fragiledonkey/clock"
 	"github.com/gkwa/fragiledonkey/duration"
+	"github.com/gkwa/fragiledonkey/inventory"
+	"github.com/gkwa/fragiledonkey/pattern"
 	"github.com/gkwa/fragiledonkey/query"
-	"github.com/spf13/viper"
-	"github.com/taylormonacelli/lemondrop"
 	"golang.org/x/sync/errgroup"
 )
 
-func RunCleanup(olderThan, newerThan string, assumeYes bool, leaveCount int, pattern string) {
-	var olderThanDuration time.Duration
+type Options struct {
+	OlderThan  string
+	NewerThan  string
+	AssumeYes  bool
+	LeaveCount int
+	Patterns   []string
+	Exclude    []string
+	// ForcePattern skips the check rejecting patterns that match every image.
+	ForcePattern bool
+	// NameRegex, when set, must also match the AMI name.
+	NameRegex *regexp.Regexp
+	// IncludeFailed also removes AMIs in a broken state (failed, error,
+	// invalid) together with their snapshots, regardless of age.
+	IncludeFailed bool
+	// Age decides which timestamp OlderThan, NewerThan and LeaveCount are
+	// measured from.
+	Age query.AgeSource
+	// TimeFormat renders ages in the printed plan.
+	TimeFormat duration.Format
+	// PlanOnly prints the plan and stops without deleting anything.
+	PlanOnly bool
+	// Interactive lets the operator review and pick individual AMIs instead
+	// of confirming whole regions.
+	Interactive bool
+	// Inventory, when set, is planned against instead of querying EC2. It
+	// requires PlanOnly.
+	Inventory *inventory.Inventory
+	// RevokeSharing removes the launch and create volume permissions of the
+	// selected AMIs and their snapshots instead of deleting them.
+	RevokeSharing bool
+	Limits        Limits
+	// AllowLargeDeletion is the number of AMIs the operator accepts deleting
+	// when a non-interactive run exceeds Limits.
+	AllowLargeDeletion int
+	// Clock supplies the time cutoffs are resolved against, the system clock
+	// when nil. Any other clock only prints the plan.
+	Clock clock.Clock
+}
 
-	var newerThanDuration time.Duration
+// planOnly reports whether the cleanup stops after printing its plan.
+// Deleting based on ages at another point in time is never what anyone
+// wants, so a clock other than the system one always only plans.
+func (o Options) planOnly() bool {
+	return o.PlanOnly || !clock.IsReal(o.Clock)
+}
 
-	var err error
+// criteria selects images by age. olderThan and newerThan are cutoff times;
+// the zero value disables them.
+type criteria struct {
+	olderThan     time.Time
+	newerThan     time.Time
+	leaveCount    int
+	includeFailed bool
+	age           query.AgeSource
+}
 
-	if olderThan != "" {
-		olderThanDuration, err = duration.ParseDuration(olderThan)
-		if err != nil {
-			fmt.Println("Error parsing older-than duration:", err)
-			return
-		}
+func (o Options) filter() query.Filter {
+	states := []string{string(types.ImageStateAvailable)}
+	if o.IncludeFailed {
+		states = append(states, query.BrokenImageStates...)
 	}
+	return query.Filter{Patterns: o.Patterns, Exclude: o.Exclude, States: states, NameRegex: o.NameRegex}
+}
 
-	if newerThan != "" {
-		newerThanDuration, err = duration.ParseDuration(newerThan)
-		if err != nil {
-			fmt.Println("Error parsing newer-than duration:", err)
-			return
+// Validate checks that opts selects something to clean up.
+func (o Options) Validate() error {
+	if o.OlderThan == "" && o.NewerThan == "" && o.LeaveCount == 0 && !o.IncludeFailed {
+		return errors.New("either --older-than, --newer-than, --leave-count-remaining, or --failed must be provided")
+	}
+	for flag, value := range map[string]string{"older-than": o.OlderThan, "newer-than": o.NewerThan} {
+		if value == "" {
+			continue
+		}
+		if _, err := duration.ParseCutoff(value, clock.Now(o.Clock)); err != nil {
+			return fmt.Errorf("invalid --%s: %w", flag, err)
 		}
 	}
+	if o.Interactive && o.AssumeYes {
+		return errors.New("--interactive cannot be combined with --assume-yes")
+	}
+	if o.Interactive && o.RevokeSharing {
+		return errors.New("--interactive cannot be combined with --revoke-sharing")
+	}
+	if !o.ForcePattern {
+		return pattern.Lint(o.Patterns)
+	}
+	return nil
+}
 
-	regionDetails, err := lemondrop.GetRegionDetails()
+// RunCleanup runs Cleanup and prints its summary. The run is returned so the
+// caller can report it, nil if the cleanup failed, only planned or revoked
+// sharing.
+func RunCleanup(ctx context.Context, opts Options) (*Run, error) {
+	run, err := Cleanup(ctx, opts)
 	if err != nil {
-		fmt.Println("Error getting region details:", err)
-		return
+		return nil, err
 	}
 
-	var g errgroup.Group
+	if opts.planOnly() || opts.RevokeSharing {
+		return nil, nil
+	}
 
-	for _, rd := range regionDetails {
-		rd := rd
+	finish(ctx, run)
 
-		g.Go(func() error {
-			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(rd.Region))
-			if err != nil {
-				fmt.Printf("Error loading config for region %s: %v\n", rd.Region, err)
-				return err
-			}
+	return run, nil
+}
 
-			client := ec2.NewFromConfig(cfg)
-			cleanupRegion(client, olderThanDuration, newerThanDuration, assumeYes, leaveCount, pattern, rd.Region)
+// Cleanup plans and executes a cleanup across all regions and returns the
+// journaled run.
+func Cleanup(ctx context.Context, opts Options) (*Run, error) {
+	now := clock.Now(opts.Clock)
 
-			return nil
-		})
+	c, err := newCriteria(opts, now)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := g.Wait(); err != nil {
-		fmt.Println("Error during cleanup:", err)
+	if opts.Inventory != nil && !opts.PlanOnly {
+		return nil, errors.New("a cleanup from an inventory file can only print its plan")
 	}
-}
-
-func cleanupRegion(client *ec2.Client, olderThanDuration, newerThanDuration time.Duration, assumeYes bool, leaveCount int, pattern, region string) {
-	amis := query.QueryAMIs(client, pattern, region)
 
-	now := time.Now()
+	run, err := NewRun(opts.filter().String())
+	if err != nil {
+		return nil, err
+	}
 
-	var imagesToDelete []query.AMI
+	plans, matched, err := buildPlans(ctx, c, opts, run)
+	if err != nil {
+		return nil, err
+	}
 
-	var snapshotsToDelete []string
+	if opts.RevokeSharing {
+		return run, revoke(ctx, plans, opts, now)
+	}
 
-	if leaveCount > 0 {
-		if len(amis) <= leaveCount {
-			if viper.GetBool("verbose") {
-				fmt.Printf("No AMIs to delete in region %s.\n", region)
-			}
+	if err := checkLimits(opts, plans, matched); err != nil {
+		return nil, err
+	}
 
-			return
+	if opts.planOnly() {
+		for _, p := range plans {
+			p.print(opts.TimeFormat, now)
 		}
 
-		sort.Slice(amis, func(i, j int) bool {
-			return amis[i].CreationDate.After(amis[j].CreationDate)
-		})
+		return run, nil
+	}
 
-		imagesToDelete = amis[leaveCount:]
-		for _, ami := range imagesToDelete {
-			snapshotsToDelete = append(snapshotsToDelete, ami.Snapshots...)
+	if opts.Interactive {
+		tty, err := openTerminal()
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		for _, ami := range amis {
-			if ami.State != "available" {
-				continue
-			}
+		defer tty.Close()
 
-			if olderThanDuration != 0 && now.Sub(ami.CreationDate) > olderThanDuration {
-				imagesToDelete = append(imagesToDelete, ami)
-				snapshotsToDelete = append(snapshotsToDelete, ami.Snapshots...)
-			} else if newerThanDuration != 0 && now.Sub(ami.CreationDate) < newerThanDuration {
-				imagesToDelete = append(imagesToDelete, ami)
-				snapshotsToDelete = append(snapshotsToDelete, ami.Snapshots...)
-			}
-		}
+		plans = reviewPlans(ctx, plans, opts.TimeFormat, now, tty, os.Stdout)
+		executePlans(ctx, plans, opts, now, run)
+
+		return run, nil
 	}
 
-	if len(imagesToDelete) == 0 && len(snapshotsToDelete) == 0 {
-		if viper.GetBool("verbose") {
-			fmt.Printf("No AMIs or snapshots to delete in region %s.\n", region)
-		}
+	if opts.AssumeYes {
+		executePlans(ctx, plans, opts, now, run)
 
-		return
+		return run, nil
 	}
 
-	fmt.Printf("AMIs to be deleted in region %s:\n", region)
+	tty, err := openTerminal()
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close()
+
+	// Interactive runs go one region at a time so prompts never interleave.
+	promptRegions(ctx, plans, opts.TimeFormat, now, tty, os.Stdout, func(p *regionPlan) {
+		executePlan(ctx, p, run)
+	})
+
+	return run, nil
+}
 
-	for _, ami := range imagesToDelete {
-		fmt.Println("-", ami.ID)
+// executePlans prints plans and then runs them concurrently.
+func executePlans(ctx context.Context, plans []*regionPlan, opts Options, now time.Time, run *Run) {
+	for _, p := range plans {
+		p.print(opts.TimeFormat, now)
 	}
 
-	fmt.Printf("Snapshots to be deleted in region %s:\n", region)
+	var g errgroup.Group
+
+	for _, p := range plans {
+		p := p
 
-	for _, snapshotID := range snapshotsToDelete {
-		fmt.Println("-", snapshotID)
+		g.Go(func() error {
+			executePlan(ctx, p, run)
+			return nil
+		})
 	}
 
-	if !assumeYes {
-		fmt.Print("Do you want to proceed with the deletion? (y/n): ")
+	_ = g.Wait()
+}
+
+// newCriteria resolves the age cutoffs in opts relative to now.
+func newCriteria(opts Options, now time.Time) (criteria, error) {
+	c := criteria{
+		leaveCount:    opts.LeaveCount,
+		includeFailed: opts.IncludeFailed,
+		age:           opts.Age,
+	}
 
-		var confirm string
+	var err error
 
-		_, err := fmt.Scanln(&confirm)
+	if opts.OlderThan != "" {
+		c.olderThan, err = duration.ParseCutoff(opts.OlderThan, now)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error confirming to delete: %v", err)
+			return criteria{}, fmt.Errorf("error parsing older-than: %w", err)
 		}
+	}
 
-		if confirm != "y" {
-			fmt.Println("Aborting deletion.")
-			return
+	if opts.NewerThan != "" {
+		c.newerThan, err = duration.ParseCutoff(opts.NewerThan, now)
+		if err != nil {
+			return criteria{}, fmt.Errorf("error parsing newer-than: %w", err)
 		}
 	}
 
-	for _, ami := range imagesToDelete {
-		input := &ec2.DeregisterImageInput{
-			ImageId: aws.String(ami.ID),
-		}
+	return c, nil
+}
 
-		_, err := client.DeregisterImage(context.Background(), input)
-		if err != nil {
-			fmt.Printf("Error deregistering AMI %s: %v\n", ami.ID, err)
+// selectImages returns the AMIs matching c. Pending images are never
+// selected since they belong to builds that are still running, and available
+// images whose age cannot be determined from c.age are kept.
+func selectImages(amis []query.AMI, c criteria) []query.AMI {
+	var available []query.AMI
+
+	ages := make(map[string]time.Time)
+
+	var selected []query.AMI
+
+	for _, ami := range amis {
+		switch {
+		case ami.State == string(types.ImageStatePending):
 			continue
+		case query.IsBrokenState(ami.State):
+			if c.includeFailed {
+				selected = append(selected, ami)
+			}
+		case ami.State == string(types.ImageStateAvailable):
+			t, err := c.age.Time(ami)
+			if err != nil {
+				slog.Warn("cannot determine age, keeping image", "region", ami.Region, "ami_id", ami.ID, "age_source", c.age.Kind, "error", err)
+				continue
+			}
+			ages[ami.ID] = t
+			available = append(available, ami)
+		}
+	}
+
+	if c.leaveCount > 0 {
+		if len(available) <= c.leaveCount {
+			return selected
 		}
 
-		fmt.Printf("Deregistered AMI: %s\n", ami.ID)
+		sort.Slice(available, func(i, j int) bool {
+			return ages[available[i].ID].After(ages[available[j].ID])
+		})
+
+		return append(selected, available[c.leaveCount:]...)
 	}
 
-	for _, snapshotID := range snapshotsToDelete {
-		input := &ec2.DeleteSnapshotInput{
-			SnapshotId: aws.String(snapshotID),
+	for _, ami := range available {
+		t := ages[ami.ID]
+		if !c.olderThan.IsZero() && t.Before(c.olderThan) {
+			selected = append(selected, ami)
+		} else if !c.newerThan.IsZero() && t.After(c.newerThan) {
+			selected = append(selected, ami)
 		}
+	}
 
-		_, err := client.DeleteSnapshot(context.Background(), input)
-		if err != nil {
-			fmt.Printf("Error deleting snapshot %s: %v\n", snapshotID, err)
-			continue
+	return selected
+}
+
+// selectSnapshots splits the snapshots backing images into those that can be
+// deleted and those still pending. Snapshots in error state are always
+// deletable since they will never complete.
+func selectSnapshots(images []query.AMI) (deletable, pending []query.Snapshot) {
+	for _, ami := range images {
+		for _, snapshot := range ami.Snapshots {
+			if snapshot.State == string(types.SnapshotStatePending) {
+				pending = append(pending, snapshot)
+				continue
+			}
+			deletable = append(deletable, snapshot)
 		}
+	}
+	return deletable, pending
+}
 
-		fmt.Printf("Deleted snapshot: %s\n", snapshotID)
+// excludeInUse drops images that running or stopped instances were launched
+// from, since deregistering them would break relaunching those instances.
+func excludeInUse(ctx context.Context, client *ec2.Client, region string, images []query.AMI) ([]query.AMI, []KeptImage, error) {
+	if len(images) == 0 {
+		return nil, nil, nil
+	}
+
+	ids := make([]string, 0, len(images))
+	for _, ami := range images {
+		ids = append(ids, ami.ID)
+	}
+
+	inUse, err := query.ImagesInUse(ctx, client, region, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var remaining []query.AMI
+
+	var kept []KeptImage
+
+	for _, ami := range images {
+		if instances, ok := inUse[ami.ID]; ok {
+			kept = append(kept, KeptImage{Region: region, ID: ami.ID, Name: ami.Name, Instances: instances})
+			continue
+		}
+		remaining = append(remaining, ami)
 	}
 
-	fmt.Printf("Cleanup completed in region %s.\n", region)
+	return remaining, kept, nil
 }
@@ -0,0 +1,338 @@
+package cleanup
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/gkwa/fragiledonkey/clock"
+	"github.com/gkwa/fragiledonkey/ec2stub"
+	"github.com/gkwa/fragiledonkey/inventory"
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+func TestSelectImages(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	amis := []query.AMI{
+		{ID: "ami-new", State: "available", CreationDate: now.Add(-1 * day)},
+		{ID: "ami-old", State: "available", CreationDate: now.Add(-20 * day)},
+		{ID: "ami-older", State: "available", CreationDate: now.Add(-30 * day)},
+		{ID: "ami-failed", State: "failed", CreationDate: now.Add(-1 * day)},
+		{ID: "ami-pending", State: "pending", CreationDate: now.Add(-40 * day)},
+	}
+
+	tests := []struct {
+		name     string
+		criteria criteria
+		expected []string
+	}{
+		{
+			name:     "older than",
+			criteria: criteria{olderThan: now.Add(-10 * day)},
+			expected: []string{"ami-old", "ami-older"},
+		},
+		{
+			name:     "newer than",
+			criteria: criteria{newerThan: now.Add(-10 * day)},
+			expected: []string{"ami-new"},
+		},
+		{
+			name:     "leave count",
+			criteria: criteria{leaveCount: 1},
+			expected: []string{"ami-old", "ami-older"},
+		},
+		{
+			name:     "failed only",
+			criteria: criteria{includeFailed: true},
+			expected: []string{"ami-failed"},
+		},
+		{
+			name:     "failed with older than",
+			criteria: criteria{olderThan: now.Add(-25 * day), includeFailed: true},
+			expected: []string{"ami-failed", "ami-older"},
+		},
+		{
+			name:     "leave count ignores failed when not requested",
+			criteria: criteria{leaveCount: 3},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectImages(amis, tt.criteria)
+
+			var ids []string
+			for _, ami := range got {
+				ids = append(ids, ami.ID)
+			}
+
+			if len(ids) != len(tt.expected) {
+				t.Fatalf("selectImages() = %v, want %v", ids, tt.expected)
+			}
+
+			for i := range ids {
+				if ids[i] != tt.expected[i] {
+					t.Errorf("selectImages() = %v, want %v", ids, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectSnapshots(t *testing.T) {
+	images := []query.AMI{
+		{
+			ID: "ami-1",
+			Snapshots: []query.Snapshot{
+				{ID: "snap-completed", State: "completed"},
+				{ID: "snap-error", State: "error"},
+			},
+		},
+		{
+			ID: "ami-2",
+			Snapshots: []query.Snapshot{
+				{ID: "snap-pending", State: "pending", Progress: "40%"},
+			},
+		},
+	}
+
+	deletable, pending := selectSnapshots(images)
+
+	if len(deletable) != 2 || deletable[0].ID != "snap-completed" || deletable[1].ID != "snap-error" {
+		t.Errorf("selectSnapshots() deletable = %v, want snap-completed and snap-error", deletable)
+	}
+
+	if len(pending) != 1 || pending[0].ID != "snap-pending" {
+		t.Errorf("selectSnapshots() pending = %v, want snap-pending", pending)
+	}
+}
+
+func TestSelectImagesNameAge(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	// Copies carry a fresh CreationDate; only the name tells their real age.
+	amis := []query.AMI{
+		{ID: "ami-copy", Name: "northflier-2026-08-01-a", State: "available", CreationDate: now},
+		{ID: "ami-recent", Name: "northflier-2026-09-28-a", State: "available", CreationDate: now},
+		{ID: "ami-undated", Name: "northflier-latest", State: "available", CreationDate: now.AddDate(-1, 0, 0)},
+	}
+
+	age, err := query.NewAgeSource(query.AgeSourceName, query.DefaultNameDateLayout, query.DefaultNameDateRegex, "")
+	if err != nil {
+		t.Fatalf("NewAgeSource() error = %v", err)
+	}
+
+	got := selectImages(amis, criteria{olderThan: now.AddDate(0, 0, -10), age: age})
+	if len(got) != 1 || got[0].ID != "ami-copy" {
+		t.Errorf("selectImages() = %v, want [ami-copy]", got)
+	}
+
+	got = selectImages(amis, criteria{leaveCount: 1, age: age})
+	if len(got) != 1 || got[0].ID != "ami-copy" {
+		t.Errorf("selectImages() with leave count = %v, want [ami-copy]", got)
+	}
+}
+
+func TestNewCriteriaAsOf(t *testing.T) {
+	asOf := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	amis := []query.AMI{
+		{ID: "ami-august", State: "available", CreationDate: time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "ami-september", State: "available", CreationDate: time.Date(2026, 9, 20, 0, 0, 0, 0, time.UTC)},
+	}
+
+	c, err := newCriteria(Options{OlderThan: "1M"}, asOf)
+	if err != nil {
+		t.Fatalf("newCriteria() error = %v", err)
+	}
+
+	if want := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC); !c.olderThan.Equal(want) {
+		t.Errorf("olderThan = %v, want %v", c.olderThan, want)
+	}
+
+	// A month before September 1 is August 1 exactly, which is not older.
+	if got := selectImages(amis, c); len(got) != 0 {
+		t.Errorf("selectImages() = %v, want none", got)
+	}
+
+	c, err = newCriteria(Options{OlderThan: "2w"}, asOf)
+	if err != nil {
+		t.Fatalf("newCriteria() error = %v", err)
+	}
+
+	if got := selectImages(amis, c); len(got) != 1 || got[0].ID != "ami-august" {
+		t.Errorf("selectImages() = %v, want [ami-august]", got)
+	}
+}
+
+func TestCleanupAsOfOnlyPlans(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		expected bool
+	}{
+		{name: "system clock", opts: Options{AssumeYes: true}, expected: false},
+		{name: "explicit system clock", opts: Options{AssumeYes: true, Clock: clock.System{}}, expected: false},
+		{name: "fixed clock", opts: Options{AssumeYes: true, Clock: clock.Fixed(time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC))}, expected: true},
+		{name: "plan only", opts: Options{PlanOnly: true}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.planOnly(); got != tt.expected {
+				t.Errorf("planOnly() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPlanInventory(t *testing.T) {
+	captured := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	inv := inventory.New("northflier-*", captured, []query.AMI{
+		{ID: "ami-old", Name: "northflier-2026-08-01-a", Region: "us-west-2", State: "available", CreationDate: captured.AddDate(0, -2, 0),
+			Snapshots: []query.Snapshot{{ID: "snap-old", State: "completed", VolumeSize: 8}}},
+		{ID: "ami-new", Name: "northflier-2026-09-30-a", Region: "us-west-2", State: "available", CreationDate: captured.AddDate(0, 0, -1)},
+		{ID: "ami-other", Name: "nginx-2026-08-01-a", Region: "us-west-2", State: "available", CreationDate: captured.AddDate(0, -2, 0)},
+		{ID: "ami-eu", Name: "northflier-2026-09-29-a", Region: "eu-central-1", State: "available", CreationDate: captured.AddDate(0, 0, -2)},
+	})
+
+	opts := Options{OlderThan: "1M", Patterns: []string{"northflier-*"}, Inventory: inv, PlanOnly: true}
+
+	c, err := newCriteria(opts, captured)
+	if err != nil {
+		t.Fatalf("newCriteria() error = %v", err)
+	}
+
+	plans, matched := planInventory(inv, c, opts)
+	if len(plans) != 1 {
+		t.Fatalf("planInventory() returned %d plans, want 1", len(plans))
+	}
+
+	// eu-central-1 has nothing to delete but its AMI still counts as matched.
+	if matched != 3 {
+		t.Errorf("planInventory() matched = %d, want 3", matched)
+	}
+
+	p := plans[0]
+	if p.region != "us-west-2" {
+		t.Errorf("plan region = %s, want us-west-2", p.region)
+	}
+
+	if len(p.images) != 1 || p.images[0].ID != "ami-old" {
+		t.Errorf("plan images = %v, want [ami-old]", p.images)
+	}
+
+	if len(p.snapshots) != 1 || p.snapshots[0].ID != "snap-old" {
+		t.Errorf("plan snapshots = %v, want [snap-old]", p.snapshots)
+	}
+}
+
+func TestCleanupAgainstStub(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	stub := ec2stub.Start(t, `
+regions: [us-west-2, eu-central-1]
+images:
+  - {id: ami-old, name: northflier-2026-08-01-a, region: us-west-2, creation_date: 2026-08-01T00:00:00Z, snapshots: [snap-old]}
+  - {id: ami-used, name: northflier-2026-08-02-a, region: us-west-2, creation_date: 2026-08-02T00:00:00Z, snapshots: [snap-used]}
+  - {id: ami-new, name: northflier-2026-09-30-a, region: us-west-2, creation_date: 2026-09-30T00:00:00Z}
+  - {id: ami-eu, name: northflier-2026-08-03-a, region: eu-central-1, creation_date: 2026-08-03T00:00:00Z}
+snapshots:
+  - {id: snap-old, region: us-west-2, description: Created by CreateImage(i-0) for ami-old, volume_size: 8}
+  - {id: snap-used, region: us-west-2, description: Created by CreateImage(i-0) for ami-used, volume_size: 8}
+instances:
+  - {id: i-1, region: us-west-2, image_id: ami-used, state: stopped}
+`, "us-west-2", "eu-central-1")
+
+	// Go through Cleanup itself, with regions pinned and an absolute cutoff
+	// so the result does not depend on today's date.
+
+	opts := Options{OlderThan: "2026-09-01", Patterns: []string{"northflier-*"}, AssumeYes: true}
+
+	run, err := Cleanup(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+
+	var remaining []string
+	for _, region := range []string{"eu-central-1", "us-west-2"} {
+		for _, image := range stub.Images(region) {
+			remaining = append(remaining, image.ID)
+		}
+		for _, snapshot := range stub.Snapshots(region) {
+			remaining = append(remaining, snapshot.ID)
+		}
+	}
+
+	expected := []string{"ami-used", "ami-new", "snap-used"}
+	if !reflect.DeepEqual(remaining, expected) {
+		t.Errorf("remaining resources = %v, want %v", remaining, expected)
+	}
+
+	if len(run.Kept) != 1 || run.Kept[0].ID != "ami-used" {
+		t.Errorf("run.Kept = %v, want ami-used", run.Kept)
+	}
+
+	if run.pendingCount() != 0 {
+		t.Errorf("run has %d pending resources, want 0", run.pendingCount())
+	}
+}
+
+func TestRevokeSharingAgainstStub(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	stub := ec2stub.Start(t, `
+regions: [us-west-2]
+images:
+  - id: ami-public
+    name: northflier-2026-08-01-a
+    region: us-west-2
+    creation_date: 2026-08-01T00:00:00Z
+    public: true
+    launch_permissions: [{user_id: "210987654321"}]
+    snapshots: [snap-public]
+  - {id: ami-private, name: northflier-2026-08-02-a, region: us-west-2, creation_date: 2026-08-02T00:00:00Z}
+  - id: ami-new
+    name: northflier-2026-09-30-a
+    region: us-west-2
+    creation_date: 2026-09-30T00:00:00Z
+    launch_permissions: [{user_id: "210987654321"}]
+snapshots:
+  - id: snap-public
+    region: us-west-2
+    description: Created by CreateImage(i-0) for ami-public
+    create_volume_permissions: [{user_id: "210987654321"}]
+instances:
+  - {id: i-1, region: us-west-2, image_id: ami-public}
+`, "us-west-2")
+
+	opts := Options{OlderThan: "2026-09-01", Patterns: []string{"northflier-*"}, AssumeYes: true, RevokeSharing: true}
+
+	if _, err := Cleanup(context.Background(), opts); err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+
+	images := stub.Images("us-west-2")
+	if len(images) != 3 {
+		t.Fatalf("images = %v, want all 3 kept", images)
+	}
+
+	for _, image := range images {
+		shared := image.Public || len(image.LaunchPermissions) > 0
+		if shared != (image.ID == "ami-new") {
+			t.Errorf("image %s public = %v permissions = %v, want only ami-new shared", image.ID, image.Public, image.LaunchPermissions)
+		}
+	}
+
+	if snapshots := stub.Snapshots("us-west-2"); len(snapshots) != 1 || len(snapshots[0].CreateVolumePermissions) != 0 {
+		t.Errorf("snapshots = %v, want snap-public unshared", snapshots)
+	}
+}
@@ -0,0 +1,72 @@
+package cleanup
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"github.com/gkwa/fragiledonkey/metrics"
+)
+
+// execute works through the remaining resources of run in region, images
+// before snapshots. Once ctx is done the call already in flight is allowed to
+// finish and everything left stays pending in the state file.
+func execute(ctx context.Context, client *ec2.Client, run *Run, region string) {
+	// Calls run on a context detached from cancellation so an interrupt never
+	// abandons a deletion halfway.
+	callBase := context.WithoutCancel(ctx)
+
+	for _, res := range run.remaining(region) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		start := time.Now()
+		callCtx, cancel := ec2client.CallContext(callBase)
+
+		var err error
+
+		action := "DeleteSnapshot"
+		idKey := "snapshot_id"
+		if res.Kind == resourceImage {
+			action = "DeregisterImage"
+			idKey = "ami_id"
+		}
+
+		if res.Kind == resourceImage {
+			_, err = client.DeregisterImage(callCtx, &ec2.DeregisterImageInput{
+				ImageId: aws.String(res.ID),
+			})
+		} else {
+			_, err = client.DeleteSnapshot(callCtx, &ec2.DeleteSnapshotInput{
+				SnapshotId: aws.String(res.ID),
+			})
+		}
+
+		cancel()
+
+		attrs := []any{"region", region, idKey, res.ID, "action", action, "duration_ms", time.Since(start).Milliseconds()}
+
+		status := statusDeleted
+
+		switch {
+		case err != nil:
+			slog.Error("error deleting resource", append(attrs, "kind", res.Kind, "error", err)...)
+			metrics.DeletionFailures.WithLabelValues(region, res.Kind).Inc()
+			status = statusFailed
+		case res.Kind == resourceImage:
+			slog.Info("deregistered image", attrs...)
+			metrics.ImagesDeleted.WithLabelValues(region).Inc()
+		default:
+			slog.Info("deleted snapshot", attrs...)
+			metrics.SnapshotsDeleted.WithLabelValues(region).Inc()
+		}
+
+		if err := run.setStatus(region, res.Kind, res.ID, status, err); err != nil {
+			slog.Error("error saving run state", "run_id", run.ID, "region", region, "error", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package cleanup
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Limits bound how much a single non-interactive cleanup may delete. Zero
+// values disable the corresponding check.
+type Limits struct {
+	MaxAMIs          int     `mapstructure:"max-amis"`
+	MaxAMIsPerRegion int     `mapstructure:"max-amis-per-region"`
+	MaxGiB           int64   `mapstructure:"max-gib"`
+	MaxPercent       float64 `mapstructure:"max-percent"`
+}
+
+// ConfiguredLimits returns the limits under cleanup.limits in the config file.
+func ConfiguredLimits() (Limits, error) {
+	var l Limits
+	err := viper.UnmarshalKey("cleanup.limits", &l)
+	return l, err
+}
+
+// violations returns a description of every limit plans exceed. matched is
+// the number of AMIs the pattern matched in every region, including regions
+// with nothing to delete and so no plan.
+func (l Limits) violations(plans []*regionPlan, matched int) []string {
+	var found []string
+
+	total := 0
+
+	var gib int64
+
+	for _, p := range plans {
+		total += len(p.images)
+		gib += p.sizeGiB()
+
+		if l.MaxAMIsPerRegion > 0 && len(p.images) > l.MaxAMIsPerRegion {
+			found = append(found, fmt.Sprintf("%d AMIs in %s exceeds max-amis-per-region %d", len(p.images), p.region, l.MaxAMIsPerRegion))
+		}
+	}
+
+	if l.MaxAMIs > 0 && total > l.MaxAMIs {
+		found = append(found, fmt.Sprintf("%d AMIs exceeds max-amis %d", total, l.MaxAMIs))
+	}
+
+	if l.MaxGiB > 0 && gib > l.MaxGiB {
+		found = append(found, fmt.Sprintf("%d GiB of snapshots exceeds max-gib %d", gib, l.MaxGiB))
+	}
+
+	if l.MaxPercent > 0 && matched > 0 {
+		percent := 100 * float64(total) / float64(matched)
+		if percent > l.MaxPercent {
+			found = append(found, fmt.Sprintf("%.0f%% of %d matched AMIs exceeds max-percent %.0f%%", percent, matched, l.MaxPercent))
+		}
+	}
+
+	return found
+}
+
+func planImageCount(plans []*regionPlan) int {
+	n := 0
+	for _, p := range plans {
+		n += len(p.images)
+	}
+	return n
+}
+
+// checkLimits refuses a non-interactive cleanup that exceeds the configured
+// limits unless the operator acknowledged at least that many AMIs with
+// --allow-large-deletion. Interactive runs only warn since every region is
+// confirmed by hand.
+func checkLimits(opts Options, plans []*regionPlan, matched int) error {
+	found := opts.Limits.violations(plans, matched)
+	if len(found) == 0 {
+		return nil
+	}
+
+	total := planImageCount(plans)
+
+	if !opts.AssumeYes || opts.planOnly() {
+		slog.Warn("cleanup is larger than the configured limits", "limits", strings.Join(found, "; "))
+		return nil
+	}
+
+	if opts.AllowLargeDeletion >= total {
+		return nil
+	}
+
+	return fmt.Errorf("refusing to delete %d AMIs non-interactively: %s; rerun with --allow-large-deletion=%d to proceed",
+		total, strings.Join(found, "; "), total)
+}
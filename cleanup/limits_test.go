@@ -0,0 +1,97 @@
+package cleanup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+func plan(region string, images int, gib int32) *regionPlan {
+	p := &regionPlan{region: region}
+	for i := 0; i < images; i++ {
+		p.images = append(p.images, query.AMI{ID: "ami"})
+		p.snapshots = append(p.snapshots, query.Snapshot{ID: "snap", VolumeSize: gib})
+	}
+	return p
+}
+
+func TestCheckLimits(t *testing.T) {
+	plans := []*regionPlan{
+		plan("us-east-1", 4, 8),
+		plan("us-west-2", 6, 8),
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		matched int
+		wantErr string
+	}{
+		{
+			name: "no limits",
+			opts: Options{AssumeYes: true},
+		},
+		{
+			name:    "max amis",
+			opts:    Options{AssumeYes: true, Limits: Limits{MaxAMIs: 5}},
+			wantErr: "10 AMIs exceeds max-amis 5",
+		},
+		{
+			name:    "max per region",
+			opts:    Options{AssumeYes: true, Limits: Limits{MaxAMIsPerRegion: 5}},
+			wantErr: "6 AMIs in us-west-2",
+		},
+		{
+			name:    "max gib",
+			opts:    Options{AssumeYes: true, Limits: Limits{MaxGiB: 50}},
+			wantErr: "80 GiB",
+		},
+		{
+			name:    "max percent",
+			opts:    Options{AssumeYes: true, Limits: Limits{MaxPercent: 40}},
+			wantErr: "50% of 20 matched",
+		},
+		{
+			// A region where nothing is old enough has no plan but its
+			// matched AMIs still count.
+			name:    "max percent with an empty region",
+			opts:    Options{AssumeYes: true, Limits: Limits{MaxPercent: 40}},
+			matched: 30,
+		},
+		{
+			name:    "acknowledged too few",
+			opts:    Options{AssumeYes: true, Limits: Limits{MaxAMIs: 5}, AllowLargeDeletion: 9},
+			wantErr: "--allow-large-deletion=10",
+		},
+		{
+			name: "acknowledged",
+			opts: Options{AssumeYes: true, Limits: Limits{MaxAMIs: 5}, AllowLargeDeletion: 10},
+		},
+		{
+			name: "interactive only warns",
+			opts: Options{Limits: Limits{MaxAMIs: 5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched := tt.matched
+			if matched == 0 {
+				matched = 20
+			}
+
+			err := checkLimits(tt.opts, plans, matched)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkLimits() error = %v, want nil", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkLimits() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
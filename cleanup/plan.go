@@ -0,0 +1,281 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/gkwa/fragiledonkey/duration"
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"github.com/gkwa/fragiledonkey/inventory"
+	"github.com/gkwa/fragiledonkey/query"
+	"golang.org/x/sync/errgroup"
+)
+
+// regionPlan is the work cleanup intends to do in a single region.
+type regionPlan struct {
+	region string
+	client *ec2.Client
+	// candidates are the images selected by age before in-use ones were
+	// moved to kept.
+	candidates []query.AMI
+	images     []query.AMI
+	snapshots  []query.Snapshot
+	pending    []query.Snapshot
+	kept       []KeptImage
+	age        query.AgeSource
+}
+
+func (p *regionPlan) sizeGiB() int64 {
+	var total int64
+	for _, snapshot := range p.snapshots {
+		total += int64(snapshot.VolumeSize)
+	}
+	return total
+}
+
+// buildPlans builds the region plans from EC2, or from opts.Inventory when
+// set, and counts the AMIs the pattern matched in every region including
+// those with nothing to delete.
+func buildPlans(ctx context.Context, c criteria, opts Options, run *Run) ([]*regionPlan, int, error) {
+	if opts.Inventory != nil {
+		plans, matched := planInventory(opts.Inventory, c, opts)
+		return plans, matched, nil
+	}
+
+	regions, err := ec2client.Regions(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return planRegions(ctx, regions, c, opts, run)
+}
+
+// planInventory builds the plans from a saved inventory without calling EC2.
+// Whether instances still use an image is unknown offline, so no image is
+// kept for being in use.
+func planInventory(inv *inventory.Inventory, c criteria, opts Options) ([]*regionPlan, int) {
+	filter := opts.filter()
+
+	byRegion := make(map[string][]query.AMI)
+
+	var matched []query.AMI
+
+	for _, ami := range inv.AMIs {
+		if filter.Matches(ami) {
+			byRegion[ami.Region] = append(byRegion[ami.Region], ami)
+			matched = append(matched, ami)
+		}
+	}
+
+	filter.WarnMixedPrefixes(matched)
+
+	slog.Warn("planning from an inventory file, images still used by instances are not detected", "captured_at", inv.CapturedAt)
+
+	if len(inv.FailedRegions) > 0 {
+		slog.Warn("inventory is missing the AMIs of regions that failed to query, they are not planned", "regions", len(inv.FailedRegions))
+	}
+
+	var plans []*regionPlan
+
+	for _, region := range inv.AMIRegions() {
+		amis := byRegion[region]
+		images := selectImages(amis, c)
+		snapshots, pending := selectSnapshots(images)
+
+		if len(images) == 0 && len(snapshots) == 0 {
+			continue
+		}
+
+		plans = append(plans, &regionPlan{
+			region:     region,
+			candidates: images,
+			images:     images,
+			snapshots:  snapshots,
+			pending:    pending,
+			age:        c.age,
+		})
+	}
+
+	return plans, len(matched)
+}
+
+// planRegions builds the plan for every region concurrently and returns the
+// non-empty ones sorted by region along with the number of AMIs matched in
+// all regions. Images kept because they are in use are recorded on run.
+func planRegions(ctx context.Context, regions []string, c criteria, opts Options, run *Run) ([]*regionPlan, int, error) {
+	var g errgroup.Group
+
+	var mu sync.Mutex
+
+	var plans []*regionPlan
+
+	var matched []query.AMI
+
+	for _, region := range regions {
+		region := region
+
+		g.Go(func() error {
+			client, err := ec2client.New(ctx, region)
+			if err != nil {
+				slog.Error("error loading config", "region", region, "error", err)
+				return err
+			}
+
+			amis := query.QueryAMIs(ctx, client, opts.filter(), region)
+
+			mu.Lock()
+			matched = append(matched, amis...)
+			mu.Unlock()
+
+			p, err := planRegion(ctx, client, c, amis, region)
+			if err != nil {
+				slog.Error("error checking whether AMIs are in use, skipping region", "region", region, "error", err)
+				run.addRegionError(region, err)
+				return nil
+			}
+
+			if len(p.kept) > 0 {
+				run.addKept(p.kept)
+			}
+
+			// Revoking sharing leaves instances running, so images kept for
+			// being in use still count.
+			if len(p.images) == 0 && len(p.snapshots) == 0 && (!opts.RevokeSharing || len(p.candidates) == 0) {
+				slog.Debug("no AMIs or snapshots to delete", "region", region)
+				return nil
+			}
+
+			mu.Lock()
+			plans = append(plans, p)
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	opts.filter().WarnMixedPrefixes(matched)
+
+	sort.Slice(plans, func(i, j int) bool {
+		return plans[i].region < plans[j].region
+	})
+
+	return plans, len(matched), nil
+}
+
+func planRegion(ctx context.Context, client *ec2.Client, c criteria, amis []query.AMI, region string) (*regionPlan, error) {
+	candidates := selectImages(amis, c)
+
+	images, kept, err := excludeInUse(ctx, client, region, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, pending := selectSnapshots(images)
+
+	return &regionPlan{
+		region:     region,
+		client:     client,
+		candidates: candidates,
+		images:     images,
+		snapshots:  snapshots,
+		pending:    pending,
+		kept:       kept,
+		age:        c.age,
+	}, nil
+}
+
+// only returns a copy of p limited to the candidates keep accepts and their
+// snapshots.
+func (p *regionPlan) only(keep func(query.AMI) bool) *regionPlan {
+	var images []query.AMI
+	for _, ami := range p.candidates {
+		if keep(ami) {
+			images = append(images, ami)
+		}
+	}
+
+	snapshots, pending := selectSnapshots(images)
+
+	reduced := *p
+	reduced.images = images
+	reduced.snapshots = snapshots
+	reduced.pending = pending
+
+	return &reduced
+}
+
+// print shows the plan on stdout with ages as of now rendered by format.
+func (p *regionPlan) print(format duration.Format, now time.Time) {
+	if len(p.kept) > 0 {
+		fmt.Printf("AMIs kept in region %s because instances still use them:\n", p.region)
+
+		for _, k := range p.kept {
+			fmt.Printf("- %s (%s)\n", k.ID, strings.Join(k.Instances, ", "))
+		}
+	}
+
+	fmt.Printf("AMIs to be deleted in region %s:\n", p.region)
+
+	for _, ami := range p.images {
+		age := "?"
+		if t, err := p.age.Time(ami); err == nil {
+			age = format.Age(t, now)
+		}
+
+		if ami.State != string(types.ImageStateAvailable) {
+			fmt.Printf("- %-21s %-*s %s (%s)\n", ami.ID, format.Width(), age, ami.Name, ami.State)
+			continue
+		}
+		fmt.Printf("- %-21s %-*s %s\n", ami.ID, format.Width(), age, ami.Name)
+	}
+
+	fmt.Printf("Snapshots to be deleted in region %s:\n", p.region)
+
+	for _, snapshot := range p.snapshots {
+		if snapshot.State == string(types.SnapshotStateError) {
+			fmt.Printf("- %s (error)\n", snapshot.ID)
+			continue
+		}
+		fmt.Println("-", snapshot.ID)
+	}
+
+	if len(p.pending) > 0 {
+		fmt.Printf("Snapshots skipped in region %s because they are still pending:\n", p.region)
+
+		for _, snapshot := range p.pending {
+			fmt.Printf("- %s (%s)\n", snapshot.ID, snapshot.Progress)
+		}
+	}
+}
+
+// executePlan journals p on run and then deletes its resources.
+func executePlan(ctx context.Context, p *regionPlan, run *Run) {
+	if err := run.addRegion(p.region, p.images, p.snapshots); err != nil {
+		slog.Error("error saving run state", "run_id", run.ID, "region", p.region, "error", err)
+		return
+	}
+
+	execute(ctx, p.client, run, p.region)
+
+	if ctx.Err() != nil {
+		slog.Warn("cleanup stopped early", "region", p.region)
+		return
+	}
+
+	slog.Info("cleanup completed", "region", p.region)
+}
@@ -0,0 +1,147 @@
+package cleanup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/duration"
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+// openTerminal opens the controlling terminal for prompts, so input piped to
+// stdin can never answer them. It is a variable for tests.
+var openTerminal = func() (io.ReadCloser, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, fmt.Errorf("cannot prompt for confirmation without a terminal, use --assume-yes to run non-interactively: %w", err)
+	}
+	return tty, nil
+}
+
+var errQuit = errors.New("quit")
+
+// readLines delivers lines from in until EOF, which closes the channel.
+func readLines(in io.Reader) <-chan string {
+	lines := make(chan string)
+
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	return lines
+}
+
+// ask prompts until the answer is one of choices. End of input and a done
+// ctx count as errQuit, so a closed terminal never deletes anything.
+func ask(ctx context.Context, lines <-chan string, out io.Writer, prompt string, choices ...string) (string, error) {
+	for {
+		fmt.Fprint(out, prompt)
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			return "", errQuit
+		case line, ok := <-lines:
+			if !ok {
+				fmt.Fprintln(out)
+				return "", errQuit
+			}
+
+			answer := strings.ToLower(strings.TrimSpace(line))
+			for _, c := range choices {
+				if answer == c {
+					return answer, nil
+				}
+			}
+
+			fmt.Fprintf(out, "Please answer %s.\n", strings.Join(choices, ", "))
+		}
+	}
+}
+
+// promptRegions shows each plan and asks what to delete from it: all, none,
+// step through the AMIs one by one, or quit every remaining region. execute
+// runs on what the operator accepted before the next region is shown.
+func promptRegions(ctx context.Context, plans []*regionPlan, format duration.Format, now time.Time, in io.Reader, out io.Writer, execute func(*regionPlan)) {
+	lines := readLines(in)
+
+	for _, p := range plans {
+		if ctx.Err() != nil {
+			return
+		}
+
+		p.print(format, now)
+
+		answer, err := ask(ctx, lines, out, "Delete these? [a]ll, [n]one, [s]tep through, [q]uit: ", "a", "y", "n", "s", "q")
+		if err != nil || answer == "q" {
+			fmt.Fprintln(out, "Aborting deletion.")
+			return
+		}
+
+		switch answer {
+		case "n":
+			fmt.Fprintf(out, "Skipping region %s.\n", p.region)
+			continue
+		case "s":
+			reduced, err := stepThrough(ctx, lines, out, p, format, now)
+			if err != nil {
+				fmt.Fprintln(out, "Aborting deletion.")
+				return
+			}
+			if len(reduced.images) > 0 {
+				execute(reduced)
+			}
+			continue
+		}
+
+		execute(p)
+	}
+}
+
+// stepThrough asks about every AMI in p and returns p reduced to the accepted
+// ones. Quitting returns errQuit and deletes nothing in the region.
+func stepThrough(ctx context.Context, lines <-chan string, out io.Writer, p *regionPlan, format duration.Format, now time.Time) (*regionPlan, error) {
+	accepted := make(map[string]bool)
+
+	var rest string
+
+	for _, ami := range p.images {
+		if rest != "" {
+			accepted[ami.ID] = rest == "a"
+			continue
+		}
+
+		age := "?"
+		if t, err := p.age.Time(ami); err == nil {
+			age = format.Age(t, now)
+		}
+
+		prompt := fmt.Sprintf("Delete %s %s (%s, %d snapshots)? [y]es, [n]o, [a]ll remaining, [d]one, [q]uit: ", ami.ID, ami.Name, age, len(ami.Snapshots))
+
+		answer, err := ask(ctx, lines, out, prompt, "y", "n", "a", "d", "q")
+		if err != nil || answer == "q" {
+			return nil, errQuit
+		}
+
+		switch answer {
+		case "y":
+			accepted[ami.ID] = true
+		case "a", "d":
+			rest = answer
+			accepted[ami.ID] = answer == "a"
+		}
+	}
+
+	return p.only(func(a query.AMI) bool { return accepted[a.ID] }), nil
+}
@@ -0,0 +1,84 @@
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/duration"
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+func promptFixture() []*regionPlan {
+	plan := func(region string, ids ...string) *regionPlan {
+		var amis []query.AMI
+		for _, id := range ids {
+			amis = append(amis, query.AMI{ID: id, Region: region, Snapshots: []query.Snapshot{{ID: "snap-" + id}}})
+		}
+		snapshots, _ := selectSnapshots(amis)
+		return &regionPlan{region: region, candidates: amis, images: amis, snapshots: snapshots}
+	}
+
+	return []*regionPlan{
+		plan("eu-central-1", "ami-e1", "ami-e2", "ami-e3"),
+		plan("us-east-1", "ami-u1"),
+		plan("us-west-2", "ami-w1"),
+	}
+}
+
+func TestPromptRegions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "step, none and all",
+			input:    "maybe\ns\ny\nd\nn\na\n",
+			expected: []string{"ami-e1", "snap-ami-e1", "ami-w1", "snap-ami-w1"},
+		},
+		{
+			name:     "step with all remaining",
+			input:    "s\nn\na\nq\n",
+			expected: []string{"ami-e2", "ami-e3", "snap-ami-e2", "snap-ami-e3"},
+		},
+		{
+			name:     "quit stops every region",
+			input:    "q\na\na\n",
+			expected: nil,
+		},
+		{
+			name:     "quit while stepping deletes nothing",
+			input:    "s\ny\nq\n",
+			expected: nil,
+		},
+		{
+			name:     "end of input deletes nothing",
+			input:    "",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			var got []string
+
+			promptRegions(context.Background(), promptFixture(), duration.Format{}, time.Now(), strings.NewReader(tt.input), &out, func(p *regionPlan) {
+				for _, ami := range p.images {
+					got = append(got, ami.ID)
+				}
+				for _, snapshot := range p.snapshots {
+					got = append(got, snapshot.ID)
+				}
+			})
+
+			if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("executed %v, want %v\n%s", got, tt.expected, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package cleanup
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+type RegionSummary struct {
+	Region           string `json:"region"`
+	ImagesDeleted    int    `json:"images_deleted"`
+	SnapshotsDeleted int    `json:"snapshots_deleted"`
+	// Failed counts resources that could not be deleted, plus one when the
+	// region was skipped altogether.
+	Failed    int `json:"failed"`
+	Gone      int `json:"gone"`
+	Remaining int `json:"remaining"`
+}
+
+// Summary returns per-region counts of the run sorted by region.
+func (r *Run) Summary() []RegionSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byRegion := make(map[string]*RegionSummary)
+
+	for _, res := range r.Resources {
+		s, ok := byRegion[res.Region]
+		if !ok {
+			s = &RegionSummary{Region: res.Region}
+			byRegion[res.Region] = s
+		}
+
+		switch res.Status {
+		case statusDeleted:
+			if res.Kind == resourceImage {
+				s.ImagesDeleted++
+			} else {
+				s.SnapshotsDeleted++
+			}
+		case statusFailed:
+			s.Failed++
+		case statusGone:
+			s.Gone++
+		case statusPending:
+			s.Remaining++
+		}
+	}
+
+	for _, e := range r.RegionErrors {
+		s, ok := byRegion[e.Region]
+		if !ok {
+			s = &RegionSummary{Region: e.Region}
+			byRegion[e.Region] = s
+		}
+		s.Failed++
+	}
+
+	summaries := make([]RegionSummary, 0, len(byRegion))
+	for _, s := range byRegion {
+		summaries = append(summaries, *s)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Region < summaries[j].Region
+	})
+
+	return summaries
+}
+
+// Print writes a per-region summary of the run.
+func (r *Run) Print(w io.Writer) {
+	for _, s := range r.Summary() {
+		fmt.Fprintf(w, "%s: %d AMIs deregistered, %d snapshots deleted, %d failed, %d already gone, %d remaining\n",
+			s.Region, s.ImagesDeleted, s.SnapshotsDeleted, s.Failed, s.Gone, s.Remaining)
+	}
+}
+
+// Failure is a resource that could not be deleted, or a region that was
+// skipped, in which case Kind is "region" and ID is empty.
+type Failure struct {
+	Region string `json:"region"`
+	Kind   string `json:"kind"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error"`
+}
+
+// Report is the outcome of a run in a form suitable for notifications.
+type Report struct {
+	RunID        string          `json:"run_id"`
+	Pattern      string          `json:"pattern"`
+	StartedAt    time.Time       `json:"started_at"`
+	Regions      []RegionSummary `json:"regions"`
+	ReclaimedGiB int64           `json:"reclaimed_gib"`
+	Failures     []Failure       `json:"failures"`
+	KeptInUse    []KeptImage     `json:"kept_in_use"`
+	// Error is why the run stopped or was refused, empty when it completed.
+	Error string `json:"error,omitempty"`
+}
+
+// FailedReport reports a cleanup with opts that failed with err. run is
+// what it did before failing and may be nil if it never started.
+func FailedReport(opts Options, run *Run, err error) Report {
+	report := Report{Pattern: opts.filter().String(), StartedAt: time.Now()}
+	if run != nil {
+		report = run.Report()
+	}
+
+	report.Error = err.Error()
+
+	return report
+}
+
+func (r *Run) Report() Report {
+	report := Report{
+		RunID:     r.ID,
+		Pattern:   r.Pattern,
+		StartedAt: r.StartedAt,
+		Regions:   r.Summary(),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, res := range r.Resources {
+		switch res.Status {
+		case statusDeleted:
+			report.ReclaimedGiB += int64(res.SizeGiB)
+		case statusFailed:
+			report.Failures = append(report.Failures, Failure{Region: res.Region, Kind: res.Kind, ID: res.ID, Error: res.Error})
+		}
+	}
+
+	for _, e := range r.RegionErrors {
+		report.Failures = append(report.Failures, Failure{Region: e.Region, Kind: resourceRegion, Error: e.Error})
+	}
+
+	report.KeptInUse = append(report.KeptInUse, r.Kept...)
+
+	return report
+}
@@ -0,0 +1,147 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"golang.org/x/sync/errgroup"
+)
+
+// RunResume continues a previously journaled run, deleting only resources
+// that are still pending or failed and still exist. The run is returned so the
+// caller can report it, nil if nothing was resumed, along with the error of a
+// region that could not be resumed.
+func RunResume(ctx context.Context, id string) (*Run, error) {
+	run, err := LoadRun(id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading run %s: %w", id, err)
+	}
+
+	if run.pendingCount() == 0 {
+		slog.Info("run has no remaining work", "run_id", run.ID)
+		return nil, nil
+	}
+
+	var g errgroup.Group
+
+	for _, region := range run.regions() {
+		region := region
+
+		if len(run.remaining(region)) == 0 {
+			continue
+		}
+
+		g.Go(func() error {
+			client, err := ec2client.New(ctx, region)
+			if err != nil {
+				slog.Error("error loading config", "region", region, "error", err)
+				return err
+			}
+
+			if err := markGone(ctx, client, run, region); err != nil {
+				slog.Error("error validating resources", "run_id", run.ID, "region", region, "error", err)
+				return err
+			}
+
+			execute(ctx, client, run, region)
+
+			return nil
+		})
+	}
+
+	err = g.Wait()
+
+	finish(ctx, run)
+
+	if err != nil {
+		return run, fmt.Errorf("error resuming run %s: %w", run.ID, err)
+	}
+
+	return run, nil
+}
+
+// markGone flags resources of run in region that no longer exist so they are
+// not retried.
+func markGone(ctx context.Context, client *ec2.Client, run *Run, region string) error {
+	var imageIDs, snapshotIDs []string
+
+	for _, res := range run.remaining(region) {
+		if res.Kind == resourceImage {
+			imageIDs = append(imageIDs, res.ID)
+		} else {
+			snapshotIDs = append(snapshotIDs, res.ID)
+		}
+	}
+
+	existing := make(map[string]bool)
+
+	if len(imageIDs) > 0 {
+		callCtx, cancel := ec2client.CallContext(ctx)
+		out, err := client.DescribeImages(callCtx, &ec2.DescribeImagesInput{
+			Filters: []types.Filter{{Name: aws.String("image-id"), Values: imageIDs}},
+			Owners:  []string{"self"},
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		for _, image := range out.Images {
+			existing[aws.ToString(image.ImageId)] = true
+		}
+	}
+
+	if len(snapshotIDs) > 0 {
+		callCtx, cancel := ec2client.CallContext(ctx)
+		out, err := client.DescribeSnapshots(callCtx, &ec2.DescribeSnapshotsInput{
+			Filters:  []types.Filter{{Name: aws.String("snapshot-id"), Values: snapshotIDs}},
+			OwnerIds: []string{"self"},
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		for _, snapshot := range out.Snapshots {
+			existing[aws.ToString(snapshot.SnapshotId)] = true
+		}
+	}
+
+	for _, res := range run.remaining(region) {
+		if existing[res.ID] {
+			continue
+		}
+
+		idKey := "snapshot_id"
+		if res.Kind == resourceImage {
+			idKey = "ami_id"
+		}
+
+		slog.Info("resource no longer exists, skipping", "run_id", run.ID, "region", region, "kind", res.Kind, idKey, res.ID)
+
+		if err := run.setStatus(region, res.Kind, res.ID, statusGone, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// finish prints the run summary and, when work is left, how to resume it.
+func finish(ctx context.Context, run *Run) {
+	if ctx.Err() != nil {
+		slog.Warn("cleanup interrupted, remaining resources were skipped", "run_id", run.ID, "error", context.Cause(ctx))
+	}
+
+	run.Print(os.Stdout)
+
+	if n := run.pendingCount(); n > 0 {
+		slog.Warn("run has remaining resources", "run_id", run.ID, "remaining", n, "resume", "fragiledonkey cleanup resume "+run.ID)
+	}
+}
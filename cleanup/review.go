@@ -0,0 +1,333 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/duration"
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+const reviewHelp = `Commands:
+  l                 list the AMIs (also an empty line)
+  t 3 5 8-10        toggle AMIs by number
+  a / n             select all / none of the listed AMIs
+  f <text>          show only AMIs whose region, id or name contains text, f alone clears
+  s age|name|region|size
+                    sort the list
+  x                 delete the selected AMIs and their snapshots
+  q                 quit without deleting
+`
+
+// reviewItem is one candidate AMI in an interactive review. Its number is its
+// index in review.items plus one and never changes.
+type reviewItem struct {
+	region   string
+	ami      query.AMI
+	age      string
+	created  time.Time
+	sizeGiB  int64
+	inUse    []string
+	selected bool
+}
+
+// review lets the operator pick, AMI by AMI, what a cleanup deletes.
+type review struct {
+	items  []reviewItem
+	order  []int
+	filter string
+	out    io.Writer
+}
+
+func newReview(plans []*regionPlan, format duration.Format, now time.Time, out io.Writer) *review {
+	r := &review{out: out}
+
+	for _, p := range plans {
+		inUse := make(map[string][]string)
+		for _, k := range p.kept {
+			inUse[k.ID] = k.Instances
+		}
+
+		for _, ami := range p.candidates {
+			item := reviewItem{region: p.region, ami: ami, age: "?", inUse: inUse[ami.ID]}
+
+			if t, err := p.age.Time(ami); err == nil {
+				item.created = t
+				item.age = format.Age(t, now)
+			}
+
+			for _, snapshot := range ami.Snapshots {
+				item.sizeGiB += int64(snapshot.VolumeSize)
+			}
+
+			item.selected = len(item.inUse) == 0
+			r.items = append(r.items, item)
+		}
+	}
+
+	// Number the items in the initial display order.
+	sort.SliceStable(r.items, func(i, j int) bool {
+		return byRegion(r.items[i], r.items[j])
+	})
+
+	r.order = make([]int, len(r.items))
+	for i := range r.order {
+		r.order[i] = i
+	}
+
+	return r
+}
+
+// visible returns the item indexes that pass the filter, in display order.
+func (r *review) visible() []int {
+	var out []int
+
+	for _, i := range r.order {
+		item := r.items[i]
+		text := strings.ToLower(item.region + " " + item.ami.ID + " " + item.ami.Name)
+		if r.filter == "" || strings.Contains(text, r.filter) {
+			out = append(out, i)
+		}
+	}
+
+	return out
+}
+
+func (r *review) list() {
+	for _, i := range r.visible() {
+		item := r.items[i]
+
+		mark := "[ ]"
+		if item.selected {
+			mark = "[x]"
+		}
+
+		status := ""
+		if len(item.inUse) > 0 {
+			status = "  in use: " + strings.Join(item.inUse, ",")
+		}
+
+		fmt.Fprintf(r.out, "%4d %s %-15s %-6s %-21s %-40s %5d GiB%s\n",
+			i+1, mark, item.region, item.age, item.ami.ID, item.ami.Name, item.sizeGiB, status)
+	}
+
+	images, snapshots, size := r.selection()
+	fmt.Fprintf(r.out, "%d of %d AMIs selected, %d snapshots, %d GiB", images, len(r.items), snapshots, size)
+	if r.filter != "" {
+		fmt.Fprintf(r.out, ", filter %q", r.filter)
+	}
+	fmt.Fprintln(r.out)
+}
+
+func (r *review) selection() (images, snapshots int, sizeGiB int64) {
+	for _, item := range r.items {
+		if item.selected {
+			images++
+			snapshots += len(item.ami.Snapshots)
+			sizeGiB += item.sizeGiB
+		}
+	}
+	return images, snapshots, sizeGiB
+}
+
+func (r *review) sort(by string) bool {
+	var less func(a, b reviewItem) bool
+
+	switch by {
+	case "age":
+		less = func(a, b reviewItem) bool { return a.created.Before(b.created) }
+	case "name":
+		less = func(a, b reviewItem) bool { return a.ami.Name < b.ami.Name }
+	case "region":
+		less = byRegion
+	case "size":
+		less = func(a, b reviewItem) bool { return a.sizeGiB > b.sizeGiB }
+	default:
+		return false
+	}
+
+	sort.SliceStable(r.order, func(i, j int) bool {
+		return less(r.items[r.order[i]], r.items[r.order[j]])
+	})
+
+	return true
+}
+
+func byRegion(a, b reviewItem) bool {
+	if a.region != b.region {
+		return a.region < b.region
+	}
+	return a.created.Before(b.created)
+}
+
+// toggle flips the items named by args, numbers or ranges like 8-10.
+func (r *review) toggle(args []string) error {
+	var numbers []int
+
+	for _, arg := range args {
+		from, to, isRange := strings.Cut(arg, "-")
+		if !isRange {
+			to = from
+		}
+
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", arg)
+		}
+
+		end, err := strconv.Atoi(to)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", arg)
+		}
+
+		if start < 1 || end > len(r.items) || start > end {
+			return fmt.Errorf("%s is out of range 1-%d", arg, len(r.items))
+		}
+
+		for n := start; n <= end; n++ {
+			numbers = append(numbers, n)
+		}
+	}
+
+	for _, n := range numbers {
+		item := &r.items[n-1]
+		if len(item.inUse) > 0 {
+			fmt.Fprintf(r.out, "%s is used by %s and cannot be selected\n", item.ami.ID, strings.Join(item.inUse, ", "))
+			continue
+		}
+		item.selected = !item.selected
+	}
+
+	return nil
+}
+
+func (r *review) selectVisible(selected bool) {
+	for _, i := range r.visible() {
+		if len(r.items[i].inUse) == 0 {
+			r.items[i].selected = selected
+		}
+	}
+}
+
+// handle runs one command line. It returns done when the review is over and
+// execute when the selection should be deleted.
+func (r *review) handle(line string) (done, execute bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		r.list()
+		return false, false
+	}
+
+	switch fields[0] {
+	case "l":
+		r.list()
+	case "t":
+		if err := r.toggle(fields[1:]); err != nil {
+			fmt.Fprintln(r.out, err)
+			return false, false
+		}
+		r.list()
+	case "a":
+		r.selectVisible(true)
+		r.list()
+	case "n":
+		r.selectVisible(false)
+		r.list()
+	case "f":
+		r.filter = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "f")))
+		r.list()
+	case "s":
+		if len(fields) != 2 || !r.sort(fields[1]) {
+			fmt.Fprintln(r.out, "sort by age, name, region or size")
+			return false, false
+		}
+		r.list()
+	case "x":
+		return true, true
+	case "q":
+		return true, false
+	default:
+		fmt.Fprint(r.out, reviewHelp)
+	}
+
+	return false, false
+}
+
+// plans returns the plans reduced to the selected images and their
+// snapshots, dropping regions left empty.
+func (r *review) plans(original []*regionPlan) []*regionPlan {
+	selected := make(map[string]bool)
+	for _, item := range r.items {
+		if item.selected {
+			selected[item.region+"/"+item.ami.ID] = true
+		}
+	}
+
+	var out []*regionPlan
+
+	for _, p := range original {
+		reduced := p.only(func(ami query.AMI) bool { return selected[p.region+"/"+ami.ID] })
+		if len(reduced.images) > 0 {
+			out = append(out, reduced)
+		}
+	}
+
+	return out
+}
+
+// reviewPlans runs an interactive review of plans reading commands from in
+// and returns the plans reduced to what the operator chose, nil when they
+// quit or ctx is done.
+func reviewPlans(ctx context.Context, plans []*regionPlan, format duration.Format, now time.Time, in io.Reader, out io.Writer) []*regionPlan {
+	r := newReview(plans, format, now, out)
+	if len(r.items) == 0 {
+		fmt.Fprintln(out, "No AMIs to review.")
+		return nil
+	}
+
+	r.list()
+	fmt.Fprint(out, "Type ? for help.\n")
+
+	lines := readLines(in)
+
+	for {
+		fmt.Fprint(out, "> ")
+
+		var line string
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			return nil
+		case l, ok := <-lines:
+			if !ok {
+				fmt.Fprintln(out)
+				return nil
+			}
+			line = l
+		}
+
+		done, execute := r.handle(line)
+		if !done {
+			continue
+		}
+
+		if !execute {
+			fmt.Fprintln(out, "Aborting deletion.")
+			return nil
+		}
+
+		chosen := r.plans(plans)
+		if len(chosen) == 0 {
+			fmt.Fprintln(out, "Nothing selected.")
+			return nil
+		}
+
+		return chosen
+	}
+}
@@ -0,0 +1,92 @@
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/duration"
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+func reviewFixture(now time.Time) []*regionPlan {
+	day := 24 * time.Hour
+
+	west := []query.AMI{
+		{ID: "ami-w1", Name: "northflier-a", CreationDate: now.Add(-30 * day), Snapshots: []query.Snapshot{{ID: "snap-w1", VolumeSize: 8}}},
+		{ID: "ami-w2", Name: "northflier-b", CreationDate: now.Add(-20 * day), Snapshots: []query.Snapshot{{ID: "snap-w2", VolumeSize: 30}}},
+		{ID: "ami-w3", Name: "northflier-c", CreationDate: now.Add(-40 * day)},
+	}
+
+	eu := []query.AMI{
+		{ID: "ami-e1", Name: "northflier-d", CreationDate: now.Add(-25 * day), Snapshots: []query.Snapshot{{ID: "snap-e1", VolumeSize: 8}}},
+	}
+
+	return []*regionPlan{
+		{region: "eu-central-1", candidates: eu, images: eu},
+		{
+			region:     "us-west-2",
+			candidates: west,
+			images:     west[:2],
+			kept:       []KeptImage{{Region: "us-west-2", ID: "ami-w3", Instances: []string{"i-1"}}},
+		},
+	}
+}
+
+func TestReviewPlans(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	// Items are numbered by region then age: 1 ami-e1, 2 ami-w3, 3 ami-w1,
+	// 4 ami-w2.
+	input := strings.Join([]string{
+		"f us-west",
+		"n",
+		"t 2",
+		"s size",
+		"t 4",
+		"f",
+		"bogus",
+		"x",
+	}, "\n")
+
+	var out bytes.Buffer
+
+	plans := reviewPlans(context.Background(), reviewFixture(now), duration.Format{}, now, strings.NewReader(input), &out)
+
+	if !strings.Contains(out.String(), "ami-w3 is used by i-1 and cannot be selected") {
+		t.Errorf("output does not refuse the in-use image:\n%s", out.String())
+	}
+
+	if !strings.Contains(out.String(), "Commands:") {
+		t.Errorf("output does not show help for an unknown command:\n%s", out.String())
+	}
+
+	var got []string
+	for _, p := range plans {
+		for _, ami := range p.images {
+			got = append(got, p.region+"/"+ami.ID)
+		}
+		for _, snapshot := range p.snapshots {
+			got = append(got, p.region+"/"+snapshot.ID)
+		}
+	}
+
+	expected := []string{"eu-central-1/ami-e1", "eu-central-1/snap-e1", "us-west-2/ami-w2", "us-west-2/snap-w2"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("reviewPlans() = %v, want %v", got, expected)
+	}
+}
+
+func TestReviewPlansQuit(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, input := range []string{"q\n", "t 1\n"} {
+		var out bytes.Buffer
+
+		if plans := reviewPlans(context.Background(), reviewFixture(now), duration.Format{}, now, strings.NewReader(input), &out); plans != nil {
+			t.Errorf("reviewPlans(%q) = %v, want nil", input, plans)
+		}
+	}
+}
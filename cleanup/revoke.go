@@ -0,0 +1,128 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/gkwa/fragiledonkey/duration"
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+// sharedPlans reduces plans to the selected AMIs that are shared, in use or
+// not, or whose sharing could not be checked. Plans built from an inventory
+// rely on the sharing it was saved with.
+func sharedPlans(ctx context.Context, plans []*regionPlan) []*regionPlan {
+	var shared []*regionPlan
+
+	for _, p := range plans {
+		if p.client != nil {
+			if err := query.FetchSharing(ctx, p.client, p.region, p.candidates); err != nil {
+				slog.Error("error fetching sharing", "region", p.region, "error", err)
+			}
+		}
+
+		reduced := p.only(func(ami query.AMI) bool { return ami.Shared() || ami.SharingUnknown() })
+		if len(reduced.images) > 0 {
+			shared = append(shared, reduced)
+		}
+	}
+
+	return shared
+}
+
+// printSharing shows who the AMIs in p and their snapshots are shared with.
+func (p *regionPlan) printSharing(format duration.Format, now time.Time) {
+	fmt.Printf("AMIs to be unshared in region %s:\n", p.region)
+
+	for _, ami := range p.images {
+		age := "?"
+		if t, err := p.age.Time(ami); err == nil {
+			age = format.Age(t, now)
+		}
+
+		fmt.Printf("- %-21s %-*s %s (%s)\n", ami.ID, format.Width(), age, ami.Name, ami.LaunchPermission)
+
+		for _, snapshot := range ami.Snapshots {
+			if snapshot.CreateVolumePermission.Shared() {
+				fmt.Printf("  - %s (%s)\n", snapshot.ID, snapshot.CreateVolumePermission)
+			}
+		}
+	}
+}
+
+// revoke removes the sharing of the selected AMIs and their snapshots instead
+// of deleting them, after confirmation unless opts.AssumeYes.
+func revoke(ctx context.Context, plans []*regionPlan, opts Options, now time.Time) error {
+	plans = sharedPlans(ctx, plans)
+
+	if len(plans) == 0 {
+		slog.Info("no shared AMIs selected")
+		return nil
+	}
+
+	count, unknown := 0, 0
+	for _, p := range plans {
+		p.printSharing(opts.TimeFormat, now)
+		count += len(p.images)
+		for _, ami := range p.images {
+			if ami.SharingUnknown() {
+				unknown++
+			}
+		}
+	}
+
+	// Sharing that could not be described may not be revoked in full, so it
+	// is never reported as done.
+	var errUnknown error
+	if unknown > 0 {
+		errUnknown = fmt.Errorf("sharing of %d %s could not be checked", unknown, english.PluralWord(unknown, "AMI", ""))
+	}
+
+	if opts.planOnly() {
+		return errUnknown
+	}
+
+	if !opts.AssumeYes {
+		tty, err := openTerminal()
+		if err != nil {
+			return err
+		}
+		defer tty.Close()
+
+		prompt := fmt.Sprintf("Revoke sharing of %d %s? [y]es, [n]o: ", count, english.PluralWord(count, "AMI", ""))
+
+		answer, err := ask(ctx, readLines(tty), os.Stdout, prompt, "y", "n")
+		if err != nil || answer == "n" {
+			fmt.Println("Aborting.")
+			return nil
+		}
+	}
+
+	failed := 0
+
+	for _, p := range plans {
+		for _, ami := range p.images {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if err := query.RevokeSharing(context.WithoutCancel(ctx), p.client, ami); err != nil {
+				slog.Error("error revoking sharing", "region", p.region, "ami_id", ami.ID, "error", err)
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		return errors.Join(fmt.Errorf("revoking sharing failed for %d %s", failed, english.PluralWord(failed, "AMI", "")), errUnknown)
+	}
+
+	slog.Info("revoked sharing", "count", count, "sharing_unknown", unknown)
+
+	return errUnknown
+}
@@ -0,0 +1,227 @@
+package cleanup
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+const (
+	resourceImage    = "image"
+	resourceSnapshot = "snapshot"
+
+	statusPending = "pending"
+	statusDeleted = "deleted"
+	statusFailed  = "failed"
+	// statusGone marks resources that had already disappeared when a run was
+	// resumed.
+	statusGone = "gone"
+
+	// resourceRegion marks failures that stopped work on a whole region.
+	resourceRegion = "region"
+)
+
+type Resource struct {
+	Region  string `json:"region"`
+	Kind    string `json:"kind"`
+	ID      string `json:"id"`
+	SizeGiB int32  `json:"size_gib,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// KeptImage is an AMI that matched the cleanup criteria but was kept because
+// instances still use it.
+type KeptImage struct {
+	Region    string   `json:"region"`
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Instances []string `json:"instances"`
+}
+
+type RegionError struct {
+	Region string `json:"region"`
+	Error  string `json:"error"`
+}
+
+// Run journals the progress of a cleanup to a state file under the XDG state
+// directory so an interrupted or partially failed run can be resumed.
+type Run struct {
+	ID        string      `json:"id"`
+	StartedAt time.Time   `json:"started_at"`
+	Pattern   string      `json:"pattern"`
+	Resources []Resource  `json:"resources"`
+	Kept      []KeptImage `json:"kept,omitempty"`
+	// RegionErrors are regions skipped because they could not be planned.
+	RegionErrors []RegionError `json:"region_errors,omitempty"`
+
+	mu   sync.Mutex
+	path string
+}
+
+func runPath(id string) (string, error) {
+	return xdg.StateFile(filepath.Join("fragiledonkey", "runs", id+".json"))
+}
+
+func newRunID(now time.Time) string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+func NewRun(pattern string) (*Run, error) {
+	now := time.Now()
+	id := newRunID(now)
+
+	path, err := runPath(id)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving state file for run %s: %w", id, err)
+	}
+
+	return &Run{ID: id, StartedAt: now, Pattern: pattern, path: path}, nil
+}
+
+func LoadRun(id string) (*Run, error) {
+	path, err := runPath(id)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving state file for run %s: %w", id, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading run %s: %w", id, err)
+	}
+
+	run := &Run{path: path}
+	if err := json.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("error parsing run %s: %w", id, err)
+	}
+
+	return run, nil
+}
+
+// addRegion records the confirmed work for region as pending and persists it
+// before anything is deleted.
+func (r *Run) addRegion(region string, images []query.AMI, snapshots []query.Snapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ami := range images {
+		r.Resources = append(r.Resources, Resource{Region: region, Kind: resourceImage, ID: ami.ID, Status: statusPending})
+	}
+
+	for _, snapshot := range snapshots {
+		r.Resources = append(r.Resources, Resource{Region: region, Kind: resourceSnapshot, ID: snapshot.ID, SizeGiB: snapshot.VolumeSize, Status: statusPending})
+	}
+
+	return r.saveLocked()
+}
+
+func (r *Run) addKept(kept []KeptImage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Kept = append(r.Kept, kept...)
+}
+
+func (r *Run) addRegionError(region string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.RegionErrors = append(r.RegionErrors, RegionError{Region: region, Error: err.Error()})
+}
+
+// remaining returns the resources in region that still need work, images
+// before snapshots.
+func (r *Run) remaining(region string) []Resource {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var images, snapshots []Resource
+
+	for _, res := range r.Resources {
+		if res.Region != region || (res.Status != statusPending && res.Status != statusFailed) {
+			continue
+		}
+
+		if res.Kind == resourceImage {
+			images = append(images, res)
+		} else {
+			snapshots = append(snapshots, res)
+		}
+	}
+
+	return append(images, snapshots...)
+}
+
+func (r *Run) regions() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]bool)
+
+	var regions []string
+
+	for _, res := range r.Resources {
+		if !seen[res.Region] {
+			seen[res.Region] = true
+			regions = append(regions, res.Region)
+		}
+	}
+
+	return regions
+}
+
+func (r *Run) setStatus(region, kind, id, status string, err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.Resources {
+		res := &r.Resources[i]
+		if res.Region == region && res.Kind == kind && res.ID == id {
+			res.Status = status
+			res.Error = ""
+			if err != nil {
+				res.Error = err.Error()
+			}
+		}
+	}
+
+	return r.saveLocked()
+}
+
+func (r *Run) pendingCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, res := range r.Resources {
+		if res.Status == statusPending || res.Status == statusFailed {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (r *Run) saveLocked() error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,63 @@
+package cleanup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+func TestRunJournal(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	run, err := NewRun("northflier-*")
+	if err != nil {
+		t.Fatalf("NewRun() error = %v", err)
+	}
+
+	images := []query.AMI{{ID: "ami-1"}, {ID: "ami-2"}}
+	snapshots := []query.Snapshot{{ID: "snap-1"}}
+
+	if err := run.addRegion("us-west-2", images, snapshots); err != nil {
+		t.Fatalf("addRegion() error = %v", err)
+	}
+
+	if err := run.setStatus("us-west-2", resourceImage, "ami-1", statusDeleted, nil); err != nil {
+		t.Fatalf("setStatus() error = %v", err)
+	}
+
+	if err := run.setStatus("us-west-2", resourceImage, "ami-2", statusFailed, errors.New("boom")); err != nil {
+		t.Fatalf("setStatus() error = %v", err)
+	}
+
+	loaded, err := LoadRun(run.ID)
+	if err != nil {
+		t.Fatalf("LoadRun() error = %v", err)
+	}
+
+	remaining := loaded.remaining("us-west-2")
+	if len(remaining) != 2 || remaining[0].ID != "ami-2" || remaining[1].ID != "snap-1" {
+		t.Errorf("remaining() = %v, want ami-2 then snap-1", remaining)
+	}
+
+	if remaining[0].Error != "boom" {
+		t.Errorf("remaining()[0].Error = %q, want %q", remaining[0].Error, "boom")
+	}
+}
+
+func TestRunReportsRegionErrors(t *testing.T) {
+	run := &Run{ID: "run-1"}
+	run.addRegionError("eu-central-1", errors.New("UnauthorizedOperation"))
+
+	summary := run.Summary()
+	if len(summary) != 1 || summary[0].Region != "eu-central-1" || summary[0].Failed != 1 {
+		t.Errorf("Summary() = %+v, want eu-central-1 with one failure", summary)
+	}
+
+	failures := run.Report().Failures
+	if len(failures) != 1 || failures[0].Kind != resourceRegion || failures[0].Error != "UnauthorizedOperation" {
+		t.Errorf("Report().Failures = %+v, want the skipped region", failures)
+	}
+}
@@ -0,0 +1,41 @@
+// Package clock provides the current time to code that selects or renders
+// AMIs by age, so a run can be evaluated as of another point in time.
+package clock
+
+import (
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the real clock.
+type System struct{}
+
+func (System) Now() time.Time { return time.Now() }
+
+// Fixed is a clock stopped at a point in time.
+type Fixed time.Time
+
+func (f Fixed) Now() time.Time { return time.Time(f) }
+
+// Now returns the time from c, or the system time when c is nil.
+func Now(c Clock) time.Time {
+	if c == nil {
+		return time.Now()
+	}
+
+	return c.Now()
+}
+
+// IsReal reports whether c follows the system time. Anything evaluated
+// against another clock must only be planned, never acted on.
+func IsReal(c Clock) bool {
+	switch c.(type) {
+	case nil, System:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,38 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNow(t *testing.T) {
+	asOf := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := Now(Fixed(asOf)); !got.Equal(asOf) {
+		t.Errorf("Now(Fixed) = %v, want %v", got, asOf)
+	}
+
+	if got := Now(nil); got.Equal(asOf) {
+		t.Errorf("Now(nil) = %v, want system time", got)
+	}
+}
+
+func TestIsReal(t *testing.T) {
+	tests := []struct {
+		name     string
+		clock    Clock
+		expected bool
+	}{
+		{name: "nil", clock: nil, expected: true},
+		{name: "system", clock: System{}, expected: true},
+		{name: "fixed", clock: Fixed(time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsReal(tt.clock); got != tt.expected {
+				t.Errorf("IsReal() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
 
 	"github.com/gkwa/fragiledonkey/cleanup"
+	"github.com/gkwa/fragiledonkey/clock"
+	"github.com/gkwa/fragiledonkey/inventory"
+	"github.com/gkwa/fragiledonkey/notify"
 	"github.com/spf13/cobra"
 )
 
@@ -12,30 +16,122 @@ var (
 	newerThan      string
 	assumeYes      bool
 	leaveCountFlag int
-	pattern        string
+	patterns       []string
+	exclude        []string
+	forcePattern   bool
+	cleanupRegex   string
+	includeFailed  bool
+	allowLarge     int
+	cleanupAge     ageFlags
+	cleanupTime    timeFormatFlags
+	inventoryPath  string
+	interactive    bool
+	revokeSharing  bool
 )
 
 var cleanupCmd = &cobra.Command{
-	Use:   "cleanup",
-	Short: "Cleanup AMIs and snapshots based on relative date",
-	Run: func(cmd *cobra.Command, args []string) {
-		if olderThan == "" && newerThan == "" && leaveCountFlag == 0 {
-			fmt.Println("Error: either --older-than, --newer-than, or --leave-count-remaining must be provided")
-			err := cmd.Help()
+	Use:          "cleanup",
+	Short:        "Cleanup AMIs and snapshots based on relative date",
+	Annotations:  map[string]string{evaluatesAsOf: "true"},
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		re, err := nameRegex(cmd, cleanupRegex, &patterns)
+		if err != nil {
+			return err
+		}
+
+		age, err := cleanupAge.ageSource()
+		if err != nil {
+			return err
+		}
+
+		format, err := cleanupTime.format()
+		if err != nil {
+			return err
+		}
+
+		limits, err := cleanup.ConfiguredLimits()
+		if err != nil {
+			return fmt.Errorf("error reading cleanup limits: %w", err)
+		}
+
+		opts := cleanup.Options{
+			OlderThan:          olderThan,
+			NewerThan:          newerThan,
+			AssumeYes:          assumeYes,
+			LeaveCount:         leaveCountFlag,
+			Patterns:           patterns,
+			Exclude:            exclude,
+			ForcePattern:       forcePattern,
+			NameRegex:          re,
+			IncludeFailed:      includeFailed,
+			Age:                age,
+			TimeFormat:         format,
+			Interactive:        interactive,
+			RevokeSharing:      revokeSharing,
+			Limits:             limits,
+			AllowLargeDeletion: allowLarge,
+			Clock:              asOf,
+		}
+
+		if inventoryPath != "" {
+			opts.Inventory, err = inventory.Load(inventoryPath)
 			if err != nil {
-				fmt.Println("Error displaying help:", err)
+				return fmt.Errorf("error loading inventory: %w", err)
 			}
-			return
+			opts.PlanOnly = true
+
+			// Judge ages as they were when the inventory was saved unless
+			// --as-of asks for another time.
+			if asOf == nil {
+				opts.Clock = clock.Fixed(opts.Inventory.CapturedAt)
+			}
+		}
+
+		if err := opts.Validate(); err != nil {
+			if err := cmd.Help(); err != nil {
+				slog.Error("error displaying help", "error", err)
+			}
+			return fmt.Errorf("invalid cleanup options: %w", err)
 		}
-		cleanup.RunCleanup(olderThan, newerThan, assumeYes, leaveCountFlag, pattern)
+		run, err := cleanup.RunCleanup(cmd.Context(), opts)
+		if err != nil {
+			return fmt.Errorf("error during cleanup: %w", err)
+		}
+		notify.Run(cmd.Context(), run)
+
+		return nil
+	},
+}
+
+var cleanupResumeCmd = &cobra.Command{
+	Use:          "resume <run-id>",
+	Short:        "Continue an interrupted or partially failed cleanup run",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		run, err := cleanup.RunResume(cmd.Context(), args[0])
+		notify.Run(cmd.Context(), run)
+		return err
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(cleanupCmd)
-	cleanupCmd.Flags().StringVar(&olderThan, "older-than", "", "Relative date for cleanup (e.g., 7d, 1M)")
-	cleanupCmd.Flags().StringVar(&newerThan, "newer-than", "", "Relative date for cleanup (e.g., 7d, 1M)")
+	cleanupCmd.AddCommand(cleanupResumeCmd)
+	cleanupCmd.Flags().StringVar(&olderThan, "older-than", "", "Age cutoff, relative (7d, 1y2M) or absolute (2024-06-01, RFC3339, last monday)")
+	cleanupCmd.Flags().StringVar(&newerThan, "newer-than", "", "Age cutoff, relative (7d, 1y2M) or absolute (2024-06-01, RFC3339, last monday)")
 	cleanupCmd.Flags().BoolVarP(&assumeYes, "assume-yes", "y", false, "Assume yes to prompts and run non-interactively")
 	cleanupCmd.Flags().IntVar(&leaveCountFlag, "leave-count-remaining", 0, "Number of newest AMIs to keep")
-	cleanupCmd.Flags().StringVar(&pattern, "pattern", "northflier-????-??-??-*", "Pattern for matching AMI names")
+	cleanupCmd.Flags().StringSliceVar(&patterns, "pattern", []string{"northflier-????-??-??-*"}, "Pattern for matching AMI names, may be repeated")
+	cleanupCmd.Flags().StringSliceVar(&exclude, "exclude", nil, "Pattern for AMI names to leave out, may be repeated")
+	cleanupCmd.Flags().StringVar(&cleanupRegex, "name-regex", "", "Regular expression AMI names must also match, evaluated after the server-side pattern")
+	cleanupCmd.Flags().BoolVar(&forcePattern, "force-pattern", false, "Allow patterns that match every image name, such as *")
+	cleanupCmd.Flags().BoolVar(&includeFailed, "failed", false, "Also remove AMIs in failed, error or invalid state and their snapshots (pending AMIs are never touched)")
+	cleanupCmd.Flags().IntVar(&allowLarge, "allow-large-deletion", 0, "Number of AMIs you accept deleting when a non-interactive run exceeds cleanup.limits")
+	cleanupAge.register(cleanupCmd)
+	cleanupTime.register(cleanupCmd)
+	cleanupCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Review the candidates and pick individual AMIs to delete")
+	cleanupCmd.Flags().BoolVar(&revokeSharing, "revoke-sharing", false, "Remove public and cross-account sharing from the selected AMIs and their snapshots instead of deleting them")
+	cleanupCmd.Flags().StringVar(&inventoryPath, "inventory", "", "Plan against an inventory saved by query --save instead of EC2, nothing is deleted")
 }
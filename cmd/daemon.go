@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gkwa/fragiledonkey/daemon"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:         "daemon",
+	Annotations: map[string]string{longRunning: "true"},
+	Short:       "Run configured cleanup policies on a schedule",
+	Long: `Run the cleanup policies listed under "daemon.policies" in the config file
+on their cron schedules until interrupted. Example config:
+
+  daemon:
+    listen: ":8080"
+    jitter: 5m
+    policies:
+      - name: northflier
+        schedule: "0 3 * * *"
+        patterns:
+          - northflier-????-??-??-*
+        leave-count-remaining: 5
+        failed: true`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var cfg daemon.Config
+		if err := viper.UnmarshalKey("daemon", &cfg); err != nil {
+			return fmt.Errorf("error reading daemon config: %w", err)
+		}
+
+		if listen, _ := cmd.Flags().GetString("listen"); cmd.Flags().Changed("listen") || cfg.Listen == "" {
+			cfg.Listen = listen
+		}
+
+		if err := daemon.Run(cmd.Context(), cfg); err != nil {
+			return fmt.Errorf("error running daemon: %w", err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.Flags().String("listen", ":8080", "Address for the /healthz and /metrics endpoints")
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/gkwa/fragiledonkey/duration"
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/spf13/cobra"
+)
+
+// nameRegex compiles --name-regex. When --pattern was left at its default the
+// patterns are replaced with a broad one derived from the regex prefix, "*"
+// when the regex has none.
+func nameRegex(cmd *cobra.Command, expr string, patterns *[]string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --name-regex: %w", err)
+	}
+
+	if !cmd.Flags().Changed("pattern") {
+		*patterns = []string{query.RegexPattern(re)}
+	}
+
+	return re, nil
+}
+
+// ageFlags holds the --age-source family of flags shared by query and
+// cleanup.
+type ageFlags struct {
+	source     string
+	nameLayout string
+	nameRegex  string
+	tag        string
+}
+
+func (f *ageFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.source, "age-source", query.AgeSourceCreation, "Timestamp AMI age is measured from: creation, name, tag or snapshot")
+	cmd.Flags().StringVar(&f.nameLayout, "age-layout", query.DefaultNameDateLayout, "Go time layout of the date in the name or tag value")
+	cmd.Flags().StringVar(&f.nameRegex, "age-name-regex", query.DefaultNameDateRegex, "Regular expression locating the date in the name, the first group is used when present")
+	cmd.Flags().StringVar(&f.tag, "age-tag", "", "Tag holding the build date when --age-source=tag")
+}
+
+func (f *ageFlags) ageSource() (query.AgeSource, error) {
+	return query.NewAgeSource(f.source, f.nameLayout, f.nameRegex, f.tag)
+}
+
+// timeFormatFlags holds --time-format and --time-zone, shared by query and
+// cleanup.
+type timeFormatFlags struct {
+	style string
+	zone  string
+}
+
+func (f *timeFormatFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.style, "time-format", duration.FormatRelative, "How ages are shown: relative (1w), precise (1w6d), hours (318h) or absolute")
+	cmd.Flags().StringVar(&f.zone, "time-zone", "", "Time zone for --time-format=absolute, e.g. Europe/Berlin (default local)")
+}
+
+func (f *timeFormatFlags) format() (duration.Format, error) {
+	return duration.NewFormat(f.style, f.zone)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/gkwa/fragiledonkey/inventory"
+	"github.com/spf13/cobra"
+)
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Work with inventories saved by query --save",
+}
+
+var inventoryDiffCmd = &cobra.Command{
+	Use:   "diff <old.json> <new.json>",
+	Short: "Show AMIs and snapshots added, removed or changed between two inventories",
+	Args:  cobra.ExactArgs(2),
+	// A missing or unreadable inventory exits non-zero, but is not a usage
+	// mistake.
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		older, err := inventory.Load(args[0])
+		if err != nil {
+			return err
+		}
+
+		newer, err := inventory.Load(args[1])
+		if err != nil {
+			return err
+		}
+
+		if older.Filter != newer.Filter {
+			slog.Warn("inventories were saved with different filters", "old", older.Filter, "new", newer.Filter)
+		}
+
+		inventory.Compare(older, newer).Print(os.Stdout)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+	inventoryCmd.AddCommand(inventoryDiffCmd)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/spf13/cobra"
+)
+
+var (
+	patternTestPatterns []string
+	patternTestExclude  []string
+	patternTestStates   []string
+	patternTestRegex    string
+)
+
+var patternCmd = &cobra.Command{
+	Use:   "pattern",
+	Short: "Check AMI name patterns before using them",
+}
+
+var patternTestCmd = &cobra.Command{
+	Use:          "test",
+	Short:        "Show what a pattern matches in every region",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		re, err := nameRegex(cmd, patternTestRegex, &patternTestPatterns)
+		if err != nil {
+			return err
+		}
+
+		filter := query.Filter{Patterns: patternTestPatterns, Exclude: patternTestExclude, States: patternTestStates, NameRegex: re}
+		return query.RunPatternTest(cmd.Context(), filter)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(patternCmd)
+	patternCmd.AddCommand(patternTestCmd)
+	patternTestCmd.Flags().StringSliceVar(&patternTestPatterns, "pattern", []string{"northflier-????-??-??-*"}, "Pattern for matching AMI names, may be repeated")
+	patternTestCmd.Flags().StringSliceVar(&patternTestExclude, "exclude", nil, "Pattern for AMI names to leave out, may be repeated")
+	patternTestCmd.Flags().StringVar(&patternTestRegex, "name-regex", "", "Regular expression AMI names must also match, evaluated after the server-side pattern")
+	patternTestCmd.Flags().StringSliceVar(&patternTestStates, "state", []string{"all"}, "AMI states to include (pending, available, invalid, failed, error, disabled or all)")
+}
@@ -1,11 +1,28 @@
 package cmd
 
 import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/clock"
+	"github.com/gkwa/fragiledonkey/inventory"
 	"github.com/gkwa/fragiledonkey/query"
 	"github.com/spf13/cobra"
 )
 
-var queryPattern string
+var (
+	queryPatterns []string
+	queryExclude  []string
+	queryStates   []string
+	queryRegex    string
+	stuckAfter    time.Duration
+	queryAge      ageFlags
+	queryTime     timeFormatFlags
+	querySave     string
+	querySharing  bool
+)
 
 // queryCmd represents the query command
 var queryCmd = &cobra.Command{
@@ -17,8 +34,49 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		query.RunQueryAllRegions(queryPattern)
+	Annotations: map[string]string{evaluatesAsOf: "true"},
+	// A failed query exits non-zero, but is not a usage mistake.
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		re, err := nameRegex(cmd, queryRegex, &queryPatterns)
+		if err != nil {
+			return err
+		}
+
+		age, err := queryAge.ageSource()
+		if err != nil {
+			return err
+		}
+
+		format, err := queryTime.format()
+		if err != nil {
+			return err
+		}
+
+		filter := query.Filter{Patterns: queryPatterns, Exclude: queryExclude, States: queryStates, NameRegex: re}
+		display := query.Display{Age: age, Format: format, StuckAfter: stuckAfter, Sharing: querySharing, Clock: asOf}
+		listing, err := query.RunQueryAllRegions(cmd.Context(), filter, display)
+		if err != nil {
+			return err
+		}
+
+		if querySave == "" {
+			return nil
+		}
+
+		// An empty result is still a valid inventory: nothing matched. Failed
+		// regions are recorded so a diff does not read them as emptied.
+		if err := inventory.Save(querySave, inventory.FromListing(filter.String(), clock.Now(asOf), listing)); err != nil {
+			return fmt.Errorf("error saving inventory: %w", err)
+		}
+
+		if failed := listing.FailedRegions(); len(failed) > 0 {
+			slog.Warn("saved inventory is missing regions that failed to query", "path", querySave, "regions", strings.Join(failed, ","))
+		}
+
+		slog.Info("saved inventory", "path", querySave, "amis", len(listing.AMIs))
+
+		return nil
 	},
 }
 
@@ -33,5 +91,13 @@ func init() {
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
-	queryCmd.Flags().StringVar(&queryPattern, "pattern", "northflier-????-??-??-*", "Pattern for matching AMI names")
+	queryCmd.Flags().StringSliceVar(&queryPatterns, "pattern", []string{"northflier-????-??-??-*"}, "Pattern for matching AMI names, may be repeated")
+	queryCmd.Flags().StringSliceVar(&queryExclude, "exclude", nil, "Pattern for AMI names to leave out, may be repeated")
+	queryCmd.Flags().StringVar(&queryRegex, "name-regex", "", "Regular expression AMI names must also match, evaluated after the server-side pattern")
+	queryCmd.Flags().StringSliceVar(&queryStates, "state", []string{"available"}, "AMI states to include (pending, available, invalid, failed, error, disabled or all)")
+	queryCmd.Flags().DurationVar(&stuckAfter, "stuck-after", 6*time.Hour, "Flag snapshots pending for longer than this")
+	queryAge.register(queryCmd)
+	queryTime.register(queryCmd)
+	queryCmd.Flags().BoolVar(&querySharing, "sharing", false, "Also fetch launch and create volume permissions and flag public or shared AMIs")
+	queryCmd.Flags().StringVar(&querySave, "save", "", "Also write the inventory to this JSON file for offline diffing and planning")
 }
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/gkwa/fragiledonkey/inventory"
+	"github.com/gkwa/fragiledonkey/pattern"
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/gkwa/fragiledonkey/replicate"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	replicatePatterns  []string
+	replicateExclude   []string
+	replicateRegex     string
+	replicateSource    string
+	replicateTargets   []string
+	replicateCount     int
+	replicateKMSKeyID  string
+	replicateDryRun    bool
+	replicateInventory string
+)
+
+var replicateCmd = &cobra.Command{
+	Use:   "replicate",
+	Short: "Copy the newest AMIs of a family to the target regions that lack them",
+	Long: `Copy the newest --count AMIs matching --pattern in --source-region to every
+target region that does not have them yet. Copies keep the source name and
+tags and are tagged with fragiledonkey:source-ami, which is how later runs
+skip them. Target regions and keys can live in the config file:
+
+  replicate:
+    targets: [eu-central-1, us-east-1]
+    count: 3
+    kms-key-id: alias/ami
+    kms-keys:
+      eu-central-1: arn:aws:kms:eu-central-1:123456789012:key/abcd`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		re, err := nameRegex(cmd, replicateRegex, &replicatePatterns)
+		if err != nil {
+			return err
+		}
+
+		if err := pattern.Lint(replicatePatterns); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+
+		if !cmd.Flags().Changed("target-region") {
+			replicateTargets = viper.GetStringSlice("replicate.targets")
+		}
+		if !cmd.Flags().Changed("count") && viper.IsSet("replicate.count") {
+			replicateCount = viper.GetInt("replicate.count")
+		}
+		if !cmd.Flags().Changed("kms-key-id") {
+			replicateKMSKeyID = viper.GetString("replicate.kms-key-id")
+		}
+		if replicateSource == "" {
+			replicateSource = viper.GetString("region")
+		}
+
+		opts := replicate.Options{
+			Filter:       query.Filter{Patterns: replicatePatterns, Exclude: replicateExclude, States: []string{"available"}, NameRegex: re},
+			SourceRegion: replicateSource,
+			Targets:      replicateTargets,
+			Count:        replicateCount,
+			KMSKeyID:     replicateKMSKeyID,
+			KMSKeys:      replicate.ConfiguredKMSKeys(),
+			PlanOnly:     replicateDryRun,
+		}
+
+		if replicateInventory != "" {
+			opts.Inventory, err = inventory.Load(replicateInventory)
+			if err != nil {
+				return fmt.Errorf("error loading inventory: %w", err)
+			}
+			opts.PlanOnly = true
+		}
+
+		if err := opts.Validate(); err != nil {
+			if err := cmd.Help(); err != nil {
+				slog.Error("error displaying help", "error", err)
+			}
+			return fmt.Errorf("invalid replicate options: %w", err)
+		}
+
+		return replicate.RunReplicate(cmd.Context(), opts)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replicateCmd)
+	replicateCmd.Flags().StringSliceVar(&replicatePatterns, "pattern", []string{"northflier-????-??-??-*"}, "Pattern for matching AMI names, may be repeated")
+	replicateCmd.Flags().StringSliceVar(&replicateExclude, "exclude", nil, "Pattern for AMI names to leave out, may be repeated")
+	replicateCmd.Flags().StringVar(&replicateRegex, "name-regex", "", "Regular expression AMI names must also match, evaluated after the server-side pattern")
+	replicateCmd.Flags().StringVar(&replicateSource, "source-region", "", "Region holding the original AMIs (default --region)")
+	replicateCmd.Flags().StringSliceVar(&replicateTargets, "target-region", nil, "Region the AMIs must exist in, may be repeated (default replicate.targets)")
+	replicateCmd.Flags().IntVar(&replicateCount, "count", 3, "Number of newest AMIs to keep copied (default replicate.count or 3)")
+	replicateCmd.Flags().StringVar(&replicateKMSKeyID, "kms-key-id", "", "Encrypt the copies with this KMS key, alias or ARN (default replicate.kms-key-id)")
+	replicateCmd.Flags().BoolVar(&replicateDryRun, "dry-run", false, "Only print which copies are present and which would be made")
+	replicateCmd.Flags().StringVar(&replicateInventory, "inventory", "", "Plan against an inventory saved by query --save instead of EC2, nothing is copied")
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/gkwa/fragiledonkey/consistency"
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"github.com/gkwa/fragiledonkey/inventory"
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	reportPatterns  []string
+	reportExclude   []string
+	reportRegex     string
+	reportGroupBy   string
+	reportNewest    int
+	reportJSON      bool
+	reportInventory string
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Reports over the AMIs matched in every region",
+}
+
+var reportConsistencyCmd = &cobra.Command{
+	Use:          "consistency",
+	Short:        "Show AMI versions missing from a region, duplicated in one, or regions lagging behind",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := consistency.ValidateGroupBy(reportGroupBy); err != nil {
+			return err
+		}
+
+		re, err := nameRegex(cmd, reportRegex, &reportPatterns)
+		if err != nil {
+			return err
+		}
+
+		filter := query.Filter{Patterns: reportPatterns, Exclude: reportExclude, States: []string{"available"}, NameRegex: re}
+
+		var (
+			amis    []query.AMI
+			unknown []string
+		)
+
+		if reportInventory != "" {
+			inv, err := inventory.Load(reportInventory)
+			if err != nil {
+				return fmt.Errorf("error loading inventory: %w", err)
+			}
+
+			for _, ami := range inv.AMIs {
+				if filter.Matches(ami) {
+					amis = append(amis, ami)
+				}
+			}
+
+			for region := range inv.FailedRegions {
+				unknown = append(unknown, region)
+			}
+		} else {
+			listing, err := query.QueryAMIsEachRegion(cmd.Context(), filter)
+			if err != nil {
+				return fmt.Errorf("error querying AMIs: %w", err)
+			}
+
+			amis, unknown = listing.AMIs, listing.FailedRegions()
+		}
+
+		regions, err := expectedRegions(cmd.Context(), reportInventory != "")
+		if err != nil {
+			return fmt.Errorf("error listing regions: %w", err)
+		}
+
+		report := consistency.Check(amis, consistency.Options{GroupBy: reportGroupBy, Newest: reportNewest, Regions: regions, Unknown: unknown})
+
+		if !reportJSON {
+			report.Print(os.Stdout)
+			return nil
+		}
+
+		return report.WriteJSON(os.Stdout)
+	},
+}
+
+// expectedRegions returns the regions every version should be in: --regions,
+// else replicate.targets, else every region enabled for the account. An
+// inventory is not compared against enabled regions, only against the ones
+// it holds.
+func expectedRegions(ctx context.Context, offline bool) ([]string, error) {
+	if regions := viper.GetStringSlice("regions"); len(regions) > 0 {
+		return regions, nil
+	}
+
+	if targets := viper.GetStringSlice("replicate.targets"); len(targets) > 0 {
+		return targets, nil
+	}
+
+	if offline {
+		return nil, nil
+	}
+
+	return ec2client.EnabledRegions(ctx)
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportConsistencyCmd)
+	reportConsistencyCmd.Flags().StringSliceVar(&reportPatterns, "pattern", []string{"northflier-????-??-??-*"}, "Pattern for matching AMI names, may be repeated")
+	reportConsistencyCmd.Flags().StringSliceVar(&reportExclude, "exclude", nil, "Pattern for AMI names to leave out, may be repeated")
+	reportConsistencyCmd.Flags().StringVar(&reportRegex, "name-regex", "", "Regular expression AMI names must also match, evaluated after the server-side pattern")
+	reportConsistencyCmd.Flags().StringVar(&reportGroupBy, "group-by", consistency.GroupByName, "What makes AMIs in different regions the same version: name or source (the source-AMI tag set by replicate)")
+	reportConsistencyCmd.Flags().IntVar(&reportNewest, "newest", 0, "Only report gaps for this many of the newest versions, 0 for all")
+	reportConsistencyCmd.Flags().BoolVar(&reportJSON, "json", false, "Write the report as JSON")
+	reportConsistencyCmd.Flags().StringVar(&reportInventory, "inventory", "", "Check an inventory saved by query --save instead of querying EC2")
+}
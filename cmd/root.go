@@ -4,10 +4,16 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
+	"context"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/gkwa/fragiledonkey/clock"
+	"github.com/gkwa/fragiledonkey/duration"
+	"github.com/gkwa/fragiledonkey/metrics"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/taylormonacelli/goldbug"
@@ -18,6 +24,20 @@ var (
 	verbose   bool
 	logFormat string
 	region    string
+	timeout   time.Duration
+
+	cancelTimeout context.CancelFunc = func() {}
+
+	// asOf is the clock set by --as-of, nil for the system clock.
+	asOf clock.Clock
+)
+
+const (
+	// longRunning is the annotation marking commands that run until
+	// interrupted and ignore --timeout.
+	longRunning = "long-running"
+	// evaluatesAsOf is the annotation marking commands that honor --as-of.
+	evaluatesAsOf = "evaluates-as-of"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -35,12 +55,73 @@ to quickly create a Cobra application.`,
 	// Run: func(cmd *cobra.Command, args []string) {
 	// 	fmt.Println("Hello from fragiledonkey!")
 	// },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if value := viper.GetString("as-of"); value != "" {
+			if cmd.Annotations[evaluatesAsOf] == "" {
+				slog.Error("--as-of only applies to query and cleanup", "command", cmd.Name())
+				os.Exit(1)
+			}
+
+			t, err := duration.ParseCutoff(value, time.Now())
+			if err != nil {
+				slog.Error("invalid --as-of", "error", err)
+				os.Exit(1)
+			}
+
+			asOf = clock.Fixed(t)
+			slog.Warn("evaluating ages as of a fixed time", "as_of", t)
+		}
+
+		// --timeout bounds one-off commands; a timeout in the shared config
+		// file must not end the daemon or the metrics server.
+		timeout = viper.GetDuration("timeout")
+		if timeout > 0 && cmd.Annotations[longRunning] != "" {
+			if cmd.Flags().Changed("timeout") {
+				slog.Warn("ignoring --timeout for a long-running command", "command", cmd.Name())
+			}
+			timeout = 0
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			cancelTimeout = cancel
+			cmd.SetContext(ctx)
+		}
+	},
+}
+
+// writeMetricsTextfile writes the metrics for node_exporter when
+// metrics-textfile is set. It runs after the command whether it failed or
+// not, since cobra skips PersistentPostRun after an error.
+func writeMetricsTextfile() {
+	path := viper.GetString("metrics-textfile")
+	if path == "" {
+		return
+	}
+
+	if err := metrics.WriteTextfile(path); err != nil {
+		slog.Error("error writing metrics textfile", "path", path, "error", err)
+		return
+	}
+
+	slog.Debug("wrote metrics textfile", "path", path)
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// After the first signal restore default handling so a second Ctrl-C
+	// terminates immediately.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	cancelTimeout()
+	writeMetricsTextfile()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -80,6 +161,76 @@ func init() {
 		os.Exit(1)
 	}
 
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "overall time limit for the command, 0 disables it; ignored by daemon and serve")
+
+	err = viper.BindPFlag("timeout", rootCmd.PersistentFlags().Lookup("timeout"))
+	if err != nil {
+		slog.Error("error binding timeout flag", "error", err)
+		os.Exit(1)
+	}
+
+	rootCmd.PersistentFlags().String("metrics-textfile", "", "write Prometheus metrics to this path for node_exporter's textfile collector")
+
+	err = viper.BindPFlag("metrics-textfile", rootCmd.PersistentFlags().Lookup("metrics-textfile"))
+	if err != nil {
+		slog.Error("error binding metrics-textfile flag", "error", err)
+		os.Exit(1)
+	}
+
+	rootCmd.PersistentFlags().Duration("call-timeout", 30*time.Second, "time limit for each AWS API call, 0 disables it")
+
+	err = viper.BindPFlag("call-timeout", rootCmd.PersistentFlags().Lookup("call-timeout"))
+	if err != nil {
+		slog.Error("error binding call-timeout flag", "error", err)
+		os.Exit(1)
+	}
+
+	rootCmd.PersistentFlags().String("endpoint-url", "", "custom EC2 endpoint, e.g. a VPC endpoint or a local stand-in")
+
+	err = viper.BindPFlag("endpoint-url", rootCmd.PersistentFlags().Lookup("endpoint-url"))
+	if err != nil {
+		slog.Error("error binding endpoint-url flag", "error", err)
+		os.Exit(1)
+	}
+
+	rootCmd.PersistentFlags().StringSlice("regions", nil, "regions to work on instead of discovering them, may be repeated")
+
+	err = viper.BindPFlag("regions", rootCmd.PersistentFlags().Lookup("regions"))
+	if err != nil {
+		slog.Error("error binding regions flag", "error", err)
+		os.Exit(1)
+	}
+
+	rootCmd.PersistentFlags().Bool("use-fips", false, "use FIPS EC2 endpoints")
+
+	err = viper.BindPFlag("use-fips", rootCmd.PersistentFlags().Lookup("use-fips"))
+	if err != nil {
+		slog.Error("error binding use-fips flag", "error", err)
+		os.Exit(1)
+	}
+
+	rootCmd.PersistentFlags().Bool("use-dualstack", false, "use dual-stack (IPv4 and IPv6) EC2 endpoints")
+
+	err = viper.BindPFlag("use-dualstack", rootCmd.PersistentFlags().Lookup("use-dualstack"))
+	if err != nil {
+		slog.Error("error binding use-dualstack flag", "error", err)
+		os.Exit(1)
+	}
+
+	rootCmd.PersistentFlags().String("as-of", "", "evaluate ages as of this time (2026-09-01, RFC3339 or 1M) in query and cleanup; cleanup only prints its plan")
+
+	err = viper.BindPFlag("as-of", rootCmd.PersistentFlags().Lookup("as-of"))
+	if err != nil {
+		slog.Error("error binding as-of flag", "error", err)
+		os.Exit(1)
+	}
+
+	err = rootCmd.PersistentFlags().MarkHidden("as-of")
+	if err != nil {
+		slog.Error("error hiding as-of flag", "error", err)
+		os.Exit(1)
+	}
+
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
@@ -110,21 +261,22 @@ func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
-	}
+	configErr := viper.ReadInConfig()
 
 	logFormat = viper.GetString("log-format")
 	verbose = viper.GetBool("verbose")
 	region = viper.GetString("region")
 
-	slog.Debug("using config file", "path", viper.ConfigFileUsed())
+	setupLogging()
+
+	if configErr == nil {
+		slog.Info("using config file", "path", viper.ConfigFileUsed())
+	}
+
 	slog.Debug("log-format", "value", logFormat)
 	slog.Debug("log-format", "value", viper.GetString("log-format"))
 	slog.Debug("region", "value", region)
 	slog.Debug("region", "value", viper.GetString("region"))
-
-	setupLogging()
 }
 
 func setupLogging() {
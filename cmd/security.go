@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/gkwa/fragiledonkey/security"
+	"github.com/spf13/cobra"
+)
+
+var (
+	securityPatterns []string
+	securityExclude  []string
+	securityRegex    string
+	securityBPA      bool
+	securityJSON     bool
+)
+
+var securityCmd = &cobra.Command{
+	Use:   "security",
+	Short: "Report public AMIs and regions without block public access, exit non-zero on violations",
+	Long: `Report matched AMIs that are public and regions where block public access
+for images or snapshots is off. The command exits with status 1 when it finds
+any violation, or cannot check a region, so it can gate a build pipeline.`,
+	// Violations are the expected failure, not a usage mistake.
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		re, err := nameRegex(cmd, securityRegex, &securityPatterns)
+		if err != nil {
+			return err
+		}
+
+		opts := security.Options{
+			Filter:                   query.Filter{Patterns: securityPatterns, Exclude: securityExclude, States: []string{"all"}, NameRegex: re},
+			RequireBlockPublicAccess: securityBPA,
+		}
+
+		report, err := security.Check(cmd.Context(), opts)
+		if err != nil {
+			return err
+		}
+
+		if securityJSON {
+			if err := report.WriteJSON(os.Stdout); err != nil {
+				return err
+			}
+		} else {
+			report.Print(os.Stdout)
+		}
+
+		if n := len(report.Violations); n > 0 {
+			return fmt.Errorf("%d policy %s", n, english.PluralWord(n, "violation", ""))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(securityCmd)
+	securityCmd.Flags().StringSliceVar(&securityPatterns, "pattern", []string{"northflier-????-??-??-*"}, "Pattern for matching AMI names, may be repeated")
+	securityCmd.Flags().StringSliceVar(&securityExclude, "exclude", nil, "Pattern for AMI names to leave out, may be repeated")
+	securityCmd.Flags().StringVar(&securityRegex, "name-regex", "", "Regular expression AMI names must also match, evaluated after the server-side pattern")
+	securityCmd.Flags().BoolVar(&securityBPA, "require-block-public-access", true, "Treat regions where image or snapshot block public access is off as violations")
+	securityCmd.Flags().BoolVar(&securityJSON, "json", false, "Write the report as JSON")
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/gkwa/fragiledonkey/serve"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr     string
+	serveInterval time.Duration
+	servePatterns []string
+	serveExclude  []string
+	serveRegex    string
+)
+
+var serveCmd = &cobra.Command{
+	Use:         "serve",
+	Annotations: map[string]string{longRunning: "true"},
+	Short:       "Serve inventory and cleanup metrics on /metrics",
+	Long: `Periodically query AMIs and snapshots across all regions and expose the
+results, together with API latency and throttle counters, in Prometheus
+format on /metrics.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		re, err := nameRegex(cmd, serveRegex, &servePatterns)
+		if err != nil {
+			return err
+		}
+
+		filter := query.Filter{Patterns: servePatterns, Exclude: serveExclude, NameRegex: re}
+		return serve.Run(cmd.Context(), serveAddr, filter, serveInterval)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&serveAddr, "listen", ":9090", "Address to serve metrics on")
+	serveCmd.Flags().DurationVar(&serveInterval, "interval", 15*time.Minute, "How often to refresh the inventory")
+	serveCmd.Flags().StringSliceVar(&servePatterns, "pattern", []string{"northflier-????-??-??-*"}, "Pattern for matching AMI names, may be repeated")
+	serveCmd.Flags().StringSliceVar(&serveExclude, "exclude", nil, "Pattern for AMI names to leave out, may be repeated")
+	serveCmd.Flags().StringVar(&serveRegex, "name-regex", "", "Regular expression AMI names must also match, evaluated after the server-side pattern")
+}
@@ -0,0 +1,274 @@
+// Package consistency compares the AMIs of a family across regions and
+// reports versions missing from a region, regions holding the same version
+// more than once, and regions whose newest version lags behind.
+package consistency
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/gkwa/fragiledonkey/replicate"
+)
+
+const (
+	// GroupByName treats AMIs with the same name as one version.
+	GroupByName = "name"
+	// GroupBySource treats an AMI and the copies tagged with its ID in
+	// replicate.SourceAMITag as one version, whatever their names.
+	GroupBySource = "source"
+)
+
+var GroupBys = []string{GroupByName, GroupBySource}
+
+type Options struct {
+	GroupBy string
+	// Newest limits the gap check to this many of the newest versions; zero
+	// checks every version.
+	Newest int
+	// Regions are the regions every version should exist in. A region in
+	// Regions holding none of the AMIs is a gap for every version; regions
+	// holding AMIs are checked whether they are listed or not.
+	Regions []string
+	// Unknown are regions whose AMIs could not be listed. They are reported
+	// as such and left out of the checks rather than seen as empty.
+	Unknown []string
+}
+
+// Version is one image of the family and its copies.
+type Version struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	// Created is the earliest creation date among the AMIs, the original's.
+	Created time.Time           `json:"created"`
+	Regions map[string][]string `json:"regions"`
+}
+
+type Gap struct {
+	Version string   `json:"version"`
+	Present []string `json:"present"`
+	Missing []string `json:"missing"`
+}
+
+type Duplicate struct {
+	Version string   `json:"version"`
+	Region  string   `json:"region"`
+	IDs     []string `json:"ids"`
+}
+
+// Skew is a region whose newest version is not the family's newest.
+type Skew struct {
+	Region string `json:"region"`
+	Latest string `json:"latest"`
+	Newest string `json:"newest"`
+	// Behind is the number of newer versions the region lacks.
+	Behind int `json:"behind"`
+}
+
+type Report struct {
+	Regions []string `json:"regions"`
+	// Unknown are regions whose AMIs could not be listed and were not
+	// checked.
+	Unknown    []string    `json:"unknown"`
+	Versions   []Version   `json:"versions"`
+	Gaps       []Gap       `json:"gaps"`
+	Duplicates []Duplicate `json:"duplicates"`
+	Skew       []Skew      `json:"skew"`
+}
+
+// Consistent reports whether r checked every region and found no gaps,
+// duplicates or skew.
+func (r Report) Consistent() bool {
+	return len(r.Unknown) == 0 && len(r.Gaps) == 0 && len(r.Duplicates) == 0 && len(r.Skew) == 0
+}
+
+func ValidateGroupBy(groupBy string) error {
+	for _, g := range GroupBys {
+		if g == groupBy {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid group-by %q, must be one of %s", groupBy, strings.Join(GroupBys, ", "))
+}
+
+func key(ami query.AMI, groupBy string) string {
+	if groupBy == GroupBySource {
+		if source := ami.Tags[replicate.SourceAMITag]; source != "" {
+			return source
+		}
+		return ami.ID
+	}
+	return ami.Name
+}
+
+// versions groups amis by opts.GroupBy, newest first.
+func versions(amis []query.AMI, groupBy string) []Version {
+	byKey := make(map[string]*Version)
+
+	var keys []string
+
+	for _, ami := range amis {
+		k := key(ami, groupBy)
+
+		v, ok := byKey[k]
+		if !ok {
+			v = &Version{Key: k, Name: ami.Name, Created: ami.CreationDate, Regions: make(map[string][]string)}
+			byKey[k] = v
+			keys = append(keys, k)
+		}
+
+		// The original is the oldest, name the version after it.
+		if ami.CreationDate.Before(v.Created) || ami.ID == k {
+			v.Created = ami.CreationDate
+			v.Name = ami.Name
+		}
+
+		v.Regions[ami.Region] = append(v.Regions[ami.Region], ami.ID)
+	}
+
+	out := make([]Version, 0, len(keys))
+	for _, k := range keys {
+		v := byKey[k]
+		for region := range v.Regions {
+			sort.Strings(v.Regions[region])
+		}
+		out = append(out, *v)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Created.Equal(out[j].Created) {
+			return out[i].Created.After(out[j].Created)
+		}
+		return out[i].Key < out[j].Key
+	})
+
+	return out
+}
+
+// Check compares amis across opts.Regions and the regions any of them are in,
+// apart from opts.Unknown.
+func Check(amis []query.AMI, opts Options) Report {
+	seen := make(map[string]bool)
+
+	unknown := append([]string{}, opts.Unknown...)
+	sort.Strings(unknown)
+
+	for _, region := range unknown {
+		seen[region] = true
+	}
+
+	var regions []string
+
+	for _, region := range opts.Regions {
+		if !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+
+	// Whatever was listed before a region failed is incomplete.
+	amis = slices.DeleteFunc(slices.Clone(amis), func(ami query.AMI) bool {
+		return slices.Contains(unknown, ami.Region)
+	})
+
+	for _, ami := range amis {
+		if !seen[ami.Region] {
+			seen[ami.Region] = true
+			regions = append(regions, ami.Region)
+		}
+	}
+
+	sort.Strings(regions)
+
+	// Scripts checking for gaps test the length of each list, so none found
+	// is written as [] instead of null.
+	r := Report{
+		Regions:    regions,
+		Unknown:    unknown,
+		Versions:   versions(amis, opts.GroupBy),
+		Gaps:       []Gap{},
+		Duplicates: []Duplicate{},
+		Skew:       []Skew{},
+	}
+
+	for i, v := range r.Versions {
+		var present, missing []string
+
+		for _, region := range regions {
+			ids := v.Regions[region]
+			if len(ids) == 0 {
+				missing = append(missing, region)
+				continue
+			}
+			present = append(present, region)
+
+			if len(ids) > 1 {
+				r.Duplicates = append(r.Duplicates, Duplicate{Version: v.Name, Region: region, IDs: ids})
+			}
+		}
+
+		if len(missing) > 0 && (opts.Newest == 0 || i < opts.Newest) {
+			r.Gaps = append(r.Gaps, Gap{Version: v.Name, Present: present, Missing: missing})
+		}
+	}
+
+	for _, region := range regions {
+		for i, v := range r.Versions {
+			if len(v.Regions[region]) == 0 {
+				continue
+			}
+			if i > 0 {
+				r.Skew = append(r.Skew, Skew{Region: region, Latest: v.Name, Newest: r.Versions[0].Name, Behind: i})
+			}
+			break
+		}
+	}
+
+	return r
+}
+
+// Print writes r for people to read.
+func (r Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "%d versions across %d regions: %s\n", len(r.Versions), len(r.Regions), strings.Join(r.Regions, ", "))
+
+	if len(r.Gaps) > 0 {
+		fmt.Fprintln(w, "Gaps:")
+		for _, g := range r.Gaps {
+			fmt.Fprintf(w, "- %s missing in %s\n", g.Version, strings.Join(g.Missing, ", "))
+		}
+	}
+
+	if len(r.Duplicates) > 0 {
+		fmt.Fprintln(w, "Duplicates:")
+		for _, d := range r.Duplicates {
+			fmt.Fprintf(w, "- %s in %s: %s\n", d.Version, d.Region, strings.Join(d.IDs, ", "))
+		}
+	}
+
+	if len(r.Skew) > 0 {
+		fmt.Fprintln(w, "Skew:")
+		for _, s := range r.Skew {
+			fmt.Fprintf(w, "- %s newest is %s, %d behind %s\n", s.Region, s.Latest, s.Behind, s.Newest)
+		}
+	}
+
+	if len(r.Unknown) > 0 {
+		fmt.Fprintf(w, "Not checked, AMIs could not be listed: %s\n", strings.Join(r.Unknown, ", "))
+	}
+
+	if r.Consistent() {
+		fmt.Fprintln(w, "All regions are consistent")
+	}
+}
+
+// WriteJSON writes r as indented JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
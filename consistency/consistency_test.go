@@ -0,0 +1,110 @@
+package consistency
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/gkwa/fragiledonkey/replicate"
+)
+
+func TestCheck(t *testing.T) {
+	day := 24 * time.Hour
+	base := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	ami := func(id, name, region string, created time.Time, source string) query.AMI {
+		a := query.AMI{ID: id, Name: name, Region: region, CreationDate: created}
+		if source != "" {
+			a.Tags = map[string]string{replicate.SourceAMITag: source}
+		}
+		return a
+	}
+
+	amis := []query.AMI{
+		ami("ami-1", "northflier-2026-09-01-a", "us-west-2", base.Add(-30*day), ""),
+		ami("ami-2", "northflier-2026-10-01-a", "us-west-2", base, ""),
+		ami("ami-3", "northflier-2026-09-01-a", "eu-central-1", base.Add(-29*day), "ami-1"),
+		ami("ami-4", "northflier-2026-09-01-a", "eu-central-1", base.Add(-28*day), ""),
+		ami("ami-5", "northflier-copy", "us-east-1", base.Add(day), "ami-2"),
+	}
+
+	tests := []struct {
+		name       string
+		opts       Options
+		gaps       []Gap
+		duplicates []Duplicate
+		skew       []Skew
+	}{
+		{
+			name: "by name",
+			opts: Options{GroupBy: GroupByName},
+			gaps: []Gap{
+				{Version: "northflier-copy", Present: []string{"us-east-1"}, Missing: []string{"eu-central-1", "us-west-2"}},
+				{Version: "northflier-2026-10-01-a", Present: []string{"us-west-2"}, Missing: []string{"eu-central-1", "us-east-1"}},
+				{Version: "northflier-2026-09-01-a", Present: []string{"eu-central-1", "us-west-2"}, Missing: []string{"us-east-1"}},
+			},
+			duplicates: []Duplicate{
+				{Version: "northflier-2026-09-01-a", Region: "eu-central-1", IDs: []string{"ami-3", "ami-4"}},
+			},
+			skew: []Skew{
+				{Region: "eu-central-1", Latest: "northflier-2026-09-01-a", Newest: "northflier-copy", Behind: 2},
+				{Region: "us-west-2", Latest: "northflier-2026-10-01-a", Newest: "northflier-copy", Behind: 1},
+			},
+		},
+		{
+			name: "by source, newest only",
+			opts: Options{GroupBy: GroupBySource, Newest: 1},
+			gaps: []Gap{
+				{Version: "northflier-2026-10-01-a", Present: []string{"us-east-1", "us-west-2"}, Missing: []string{"eu-central-1"}},
+			},
+			duplicates: []Duplicate{},
+			skew: []Skew{
+				{Region: "eu-central-1", Latest: "northflier-2026-09-01-a", Newest: "northflier-2026-10-01-a", Behind: 1},
+			},
+		},
+		{
+			name: "expected region without AMIs",
+			opts: Options{GroupBy: GroupBySource, Newest: 1, Regions: []string{"us-west-2", "ap-south-1"}},
+			gaps: []Gap{
+				{Version: "northflier-2026-10-01-a", Present: []string{"us-east-1", "us-west-2"}, Missing: []string{"ap-south-1", "eu-central-1"}},
+			},
+			duplicates: []Duplicate{},
+			skew: []Skew{
+				{Region: "eu-central-1", Latest: "northflier-2026-09-01-a", Newest: "northflier-2026-10-01-a", Behind: 1},
+			},
+		},
+		{
+			name:       "regions that failed to query",
+			opts:       Options{GroupBy: GroupBySource, Newest: 1, Regions: []string{"us-west-2", "ap-south-1"}, Unknown: []string{"eu-central-1", "ap-south-1"}},
+			gaps:       []Gap{},
+			duplicates: []Duplicate{},
+			skew:       []Skew{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Check(amis, tt.opts)
+
+			if len(tt.opts.Unknown) > 0 {
+				if want := []string{"ap-south-1", "eu-central-1"}; !reflect.DeepEqual(r.Unknown, want) {
+					t.Errorf("Unknown = %v, want %v", r.Unknown, want)
+				}
+				if r.Consistent() {
+					t.Error("Consistent() = true with regions left unchecked")
+				}
+			}
+
+			if !reflect.DeepEqual(r.Gaps, tt.gaps) {
+				t.Errorf("Gaps = %+v, want %+v", r.Gaps, tt.gaps)
+			}
+			if !reflect.DeepEqual(r.Duplicates, tt.duplicates) {
+				t.Errorf("Duplicates = %+v, want %+v", r.Duplicates, tt.duplicates)
+			}
+			if !reflect.DeepEqual(r.Skew, tt.skew) {
+				t.Errorf("Skew = %+v, want %+v", r.Skew, tt.skew)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/cleanup"
+	"github.com/gkwa/fragiledonkey/metrics"
+	"github.com/gkwa/fragiledonkey/notify"
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robfig/cron/v3"
+)
+
+type Policy struct {
+	Name       string   `mapstructure:"name"`
+	Schedule   string   `mapstructure:"schedule"`
+	Patterns   []string `mapstructure:"patterns"`
+	Exclude    []string `mapstructure:"exclude"`
+	NameRegex  string   `mapstructure:"name-regex"`
+	OlderThan  string   `mapstructure:"older-than"`
+	NewerThan  string   `mapstructure:"newer-than"`
+	LeaveCount int      `mapstructure:"leave-count-remaining"`
+	Failed     bool     `mapstructure:"failed"`
+	// AgeSource, AgeLayout, AgeNameRegex and AgeTag choose the timestamp
+	// age is measured from, see query.AgeSource.
+	AgeSource    string `mapstructure:"age-source"`
+	AgeLayout    string `mapstructure:"age-layout"`
+	AgeNameRegex string `mapstructure:"age-name-regex"`
+	AgeTag       string `mapstructure:"age-tag"`
+	// ForcePattern allows patterns matching every image, see
+	// cleanup.Options.
+	ForcePattern bool `mapstructure:"force-pattern"`
+	// AllowLargeDeletion acknowledges runs that exceed cleanup.limits, see
+	// cleanup.Options.
+	AllowLargeDeletion int `mapstructure:"allow-large-deletion"`
+}
+
+func (p Policy) options() (cleanup.Options, error) {
+	patterns := p.Patterns
+
+	var re *regexp.Regexp
+
+	if p.NameRegex != "" {
+		var err error
+
+		re, err = regexp.Compile(p.NameRegex)
+		if err != nil {
+			return cleanup.Options{}, fmt.Errorf("invalid name-regex: %w", err)
+		}
+
+		if len(patterns) == 0 {
+			patterns = []string{query.RegexPattern(re)}
+		}
+	}
+
+	layout := p.AgeLayout
+	if layout == "" {
+		layout = query.DefaultNameDateLayout
+	}
+
+	nameRegex := p.AgeNameRegex
+	if nameRegex == "" {
+		nameRegex = query.DefaultNameDateRegex
+	}
+
+	age, err := query.NewAgeSource(p.AgeSource, layout, nameRegex, p.AgeTag)
+	if err != nil {
+		return cleanup.Options{}, err
+	}
+
+	return cleanup.Options{
+		OlderThan:          p.OlderThan,
+		NewerThan:          p.NewerThan,
+		AssumeYes:          true,
+		LeaveCount:         p.LeaveCount,
+		Patterns:           patterns,
+		Exclude:            p.Exclude,
+		ForcePattern:       p.ForcePattern,
+		IncludeFailed:      p.Failed,
+		Age:                age,
+		AllowLargeDeletion: p.AllowLargeDeletion,
+		NameRegex:          re,
+	}, nil
+}
+
+type Config struct {
+	Listen   string        `mapstructure:"listen"`
+	Jitter   time.Duration `mapstructure:"jitter"`
+	Policies []Policy      `mapstructure:"policies"`
+}
+
+type policyStatus struct {
+	RunID      string    `json:"run_id,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	NextRun    time.Time `json:"next_run"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type daemon struct {
+	cfg Config
+
+	// running holds a token while a cleanup runs. Policies firing together
+	// queue for it rather than racing over the same images or being skipped.
+	// Other daemon processes are kept out by the lock file taken in Run.
+	running chan struct{}
+	// queued, when set, receives the name of a policy that has to wait for
+	// another run to finish.
+	queued chan string
+
+	mu     sync.Mutex
+	status map[string]*policyStatus
+}
+
+func newDaemon(cfg Config) *daemon {
+	return &daemon{cfg: cfg, running: make(chan struct{}, 1), status: make(map[string]*policyStatus)}
+}
+
+type scheduled struct {
+	policy   Policy
+	schedule cron.Schedule
+}
+
+// Run executes the configured policies on their schedules until ctx is done.
+func Run(ctx context.Context, cfg Config) error {
+	if len(cfg.Policies) == 0 {
+		return errors.New("no daemon policies configured")
+	}
+
+	var jobs []scheduled
+
+	for _, p := range cfg.Policies {
+		if p.Name == "" {
+			return errors.New("daemon policy is missing a name")
+		}
+
+		schedule, err := cron.ParseStandard(p.Schedule)
+		if err != nil {
+			return fmt.Errorf("policy %s: invalid schedule %q: %w", p.Name, p.Schedule, err)
+		}
+
+		opts, err := p.options()
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+
+		if err := opts.Validate(); err != nil {
+			return fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+
+		jobs = append(jobs, scheduled{policy: p, schedule: schedule})
+	}
+
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	d := newDaemon(cfg)
+
+	if cfg.Listen != "" {
+		go d.serve(ctx)
+	}
+
+	var wg sync.WaitGroup
+
+	for _, job := range jobs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			d.loop(ctx, job)
+		}()
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func (d *daemon) loop(ctx context.Context, job scheduled) {
+	for {
+		next := job.schedule.Next(time.Now())
+		if d.cfg.Jitter > 0 {
+			next = next.Add(rand.N(d.cfg.Jitter))
+		}
+
+		d.setStatus(job.policy.Name, func(s *policyStatus) { s.NextRun = next })
+		slog.Info("scheduled policy", "policy", job.policy.Name, "next_run", next)
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		d.runPolicy(ctx, job.policy)
+	}
+}
+
+func (d *daemon) runPolicy(ctx context.Context, p Policy) {
+	select {
+	case d.running <- struct{}{}:
+	default:
+		slog.Info("waiting for another policy run to finish", "policy", p.Name)
+		if d.queued != nil {
+			d.queued <- p.Name
+		}
+
+		select {
+		case d.running <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+	}
+	defer func() { <-d.running }()
+
+	start := time.Now()
+	d.setStatus(p.Name, func(s *policyStatus) {
+		s.StartedAt = start
+		s.Error = ""
+	})
+
+	slog.Info("starting policy run", "policy", p.Name, "patterns", strings.Join(p.Patterns, ","))
+
+	var run *cleanup.Run
+
+	opts, err := p.options()
+	if err == nil {
+		opts.Limits, err = cleanup.ConfiguredLimits()
+	}
+	if err == nil {
+		run, err = cleanup.Cleanup(ctx, opts)
+	}
+
+	d.setStatus(p.Name, func(s *policyStatus) {
+		s.FinishedAt = time.Now()
+		if err != nil {
+			s.Error = err.Error()
+		}
+		if run != nil {
+			s.RunID = run.ID
+		}
+	})
+
+	if err != nil {
+		slog.Error("policy run failed", "policy", p.Name, "error", err)
+		notify.Failed(ctx, cleanup.FailedReport(opts, run, err))
+		return
+	}
+
+	for _, s := range run.Summary() {
+		slog.Info("policy run summary",
+			"policy", p.Name,
+			"run_id", run.ID,
+			"region", s.Region,
+			"images_deleted", s.ImagesDeleted,
+			"snapshots_deleted", s.SnapshotsDeleted,
+			"failed", s.Failed,
+			"remaining", s.Remaining)
+	}
+
+	slog.Info("finished policy run", "policy", p.Name, "run_id", run.ID, "duration_ms", time.Since(start).Milliseconds())
+
+	notify.Run(ctx, run)
+}
+
+func (d *daemon) setStatus(name string, update func(*policyStatus)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.status[name]
+	if !ok {
+		s = &policyStatus{}
+		d.status[name] = s
+	}
+
+	update(s)
+}
+
+func (d *daemon) handleHealth(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(map[string]any{
+		"status":   "ok",
+		"policies": d.status,
+	})
+	if err != nil {
+		slog.Error("error writing health response", "error", err)
+	}
+}
+
+func (d *daemon) serve(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", d.handleHealth)
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              d.cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("error shutting down health server", "error", err)
+		}
+	}()
+
+	slog.Info("serving health endpoint", "addr", d.cfg.Listen)
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("error serving health endpoint", "addr", d.cfg.Listen, "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{
+			name:    "no policies",
+			cfg:     Config{},
+			wantErr: "no daemon policies",
+		},
+		{
+			name:    "missing name",
+			cfg:     Config{Policies: []Policy{{Schedule: "@daily", OlderThan: "7d"}}},
+			wantErr: "missing a name",
+		},
+		{
+			name:    "bad schedule",
+			cfg:     Config{Policies: []Policy{{Name: "nightly", Schedule: "whenever", OlderThan: "7d"}}},
+			wantErr: "invalid schedule",
+		},
+		{
+			name:    "no criteria",
+			cfg:     Config{Policies: []Policy{{Name: "nightly", Schedule: "0 3 * * *"}}},
+			wantErr: "must be provided",
+		},
+		{
+			name:    "regex without a literal prefix",
+			cfg:     Config{Policies: []Policy{{Name: "nightly", Schedule: "@daily", OlderThan: "7d", NameRegex: `^(northflier|nginx)-`}}},
+			wantErr: "use --force-pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(context.Background(), tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Run() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunPolicyWaitsWhenBusy(t *testing.T) {
+	d := newDaemon(Config{})
+
+	started := func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		s, ok := d.status["nightly"]
+		return ok && !s.StartedAt.IsZero()
+	}
+
+	d.queued = make(chan string)
+	d.running <- struct{}{}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		// An invalid policy fails right after starting, without calling AWS.
+		d.runPolicy(context.Background(), Policy{Name: "nightly", NameRegex: "("})
+	}()
+
+	if name := <-d.queued; name != "nightly" {
+		t.Fatalf("queued policy = %q, want nightly", name)
+	}
+
+	if started() {
+		t.Fatalf("runPolicy() started while another run was in progress")
+	}
+
+	<-d.running
+	<-done
+
+	if !started() {
+		t.Errorf("runPolicy() never ran after the other run finished")
+	}
+}
+
+func TestRunPolicyStopsWaitingWhenCancelled(t *testing.T) {
+	d := newDaemon(Config{})
+	d.running <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	d.runPolicy(ctx, Policy{Name: "nightly"})
+
+	if s, ok := d.status["nightly"]; ok && !s.StartedAt.IsZero() {
+		t.Errorf("runPolicy() started after its context was cancelled")
+	}
+}
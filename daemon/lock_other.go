@@ -0,0 +1,9 @@
+//go:build !unix
+
+package daemon
+
+// lock is a no-op where flock is unavailable; there, only policies within
+// one daemon process are kept from running at once.
+func lock() (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/adrg/xdg"
+)
+
+// lock takes an exclusive lock on a file in the state directory so a second
+// daemon sharing it refuses to start instead of running policies alongside
+// the first. The lock is released when the process exits.
+func lock() (func(), error) {
+	path, err := xdg.StateFile(filepath.Join("fragiledonkey", "daemon.lock"))
+	if err != nil {
+		return nil, fmt.Errorf("error resolving daemon lock file: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening daemon lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("another daemon holds %s: %w", path, err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
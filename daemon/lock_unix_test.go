@@ -0,0 +1,31 @@
+//go:build unix
+
+package daemon
+
+import (
+	"testing"
+
+	"github.com/adrg/xdg"
+)
+
+func TestLockRefusesSecondDaemon(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	unlock, err := lock()
+	if err != nil {
+		t.Fatalf("lock() error = %v", err)
+	}
+
+	if _, err := lock(); err == nil {
+		t.Fatal("second lock() succeeded while the first is held")
+	}
+
+	unlock()
+
+	unlock, err = lock()
+	if err != nil {
+		t.Fatalf("lock() after unlock error = %v", err)
+	}
+	unlock()
+}
@@ -0,0 +1,140 @@
+package duration
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// ParseCutoff turns s into a point in time relative to ref. It accepts
+//
+//   - compound relative ages such as "7d" or "1y2M3d", subtracted from ref
+//     with calendar arithmetic for years, months and days
+//   - absolute dates "2024-06-01" (midnight in ref's location) and RFC3339
+//     timestamps
+//   - "today", "yesterday" and "last <weekday>", meaning midnight of that
+//     day in ref's location
+func ParseCutoff(s string, ref time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", s, ref.Location()); err == nil {
+		return t, nil
+	}
+
+	midnight := time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, ref.Location())
+
+	switch lower := strings.ToLower(s); {
+	case lower == "today":
+		return midnight, nil
+	case lower == "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	case strings.HasPrefix(lower, "last "):
+		day, ok := weekdays[strings.TrimSpace(strings.TrimPrefix(lower, "last "))]
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid weekday in %q", s)
+		}
+
+		// "last monday" on a Monday is a week ago, never today.
+		back := (int(ref.Weekday()) - int(day) + 7) % 7
+		if back == 0 {
+			back = 7
+		}
+
+		return midnight.AddDate(0, 0, -back), nil
+	}
+
+	return subtract(s, ref)
+}
+
+// subtract parses a compound duration like "1y2M3d12h" and subtracts it from
+// ref. Years, months and whole days or weeks move the calendar date, clamping
+// to the last day of the month so that one month before March 31 is the end
+// of February. Fractional days and weeks are fixed durations.
+func subtract(s string, ref time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, fmt.Errorf("invalid duration format: %q", s)
+	}
+
+	var years, months, days int
+
+	var fixed time.Duration
+
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && (rest[i] >= '0' && rest[i] <= '9' || rest[i] == '.') {
+			i++
+		}
+
+		if i == 0 || i == len(rest) {
+			return time.Time{}, fmt.Errorf("invalid duration format: %s", s)
+		}
+
+		value, unit := rest[:i], rest[i]
+		rest = rest[i+1:]
+
+		n, err := strconv.Atoi(value)
+		whole := err == nil
+
+		switch {
+		case unit == 'y' || unit == 'M':
+			if !whole {
+				return time.Time{}, fmt.Errorf("invalid duration value %q, %c takes whole numbers", value, unit)
+			}
+
+			if unit == 'y' {
+				years += n
+			} else {
+				months += n
+			}
+		case unit == 'd' && whole:
+			days += n
+		case unit == 'w' && whole:
+			days += 7 * n
+		case strings.IndexByte("dwhms", unit) >= 0:
+			// Fractional days and weeks such as 1.5d stay fixed 24h
+			// multiples, as ParseDuration has always treated them.
+			d, err := ParseDuration(value + string(unit))
+			if err != nil {
+				return time.Time{}, err
+			}
+
+			fixed += d
+		default:
+			return time.Time{}, fmt.Errorf("invalid duration unit %q in %s", unit, s)
+		}
+	}
+
+	return addMonthsClamped(ref, -(12*years+months)).AddDate(0, 0, -days).Add(-fixed), nil
+}
+
+func addMonthsClamped(t time.Time, months int) time.Time {
+	if months == 0 {
+		return t
+	}
+
+	first := time.Date(t.Year(), t.Month(), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location()).AddDate(0, months, 0)
+	last := first.AddDate(0, 1, -1).Day()
+
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+
+	return first.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,50 @@
+package duration
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCutoff(t *testing.T) {
+	// A Tuesday.
+	ref := time.Date(2026, 3, 31, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{name: "days", input: "7d", expected: time.Date(2026, 3, 24, 15, 30, 0, 0, time.UTC)},
+		{name: "month clamps to end of february", input: "1M", expected: time.Date(2026, 2, 28, 15, 30, 0, 0, time.UTC)},
+		{name: "compound", input: "1y2M3d", expected: time.Date(2025, 1, 28, 15, 30, 0, 0, time.UTC)},
+		{name: "weeks and hours", input: "1w2h", expected: time.Date(2026, 3, 24, 13, 30, 0, 0, time.UTC)},
+		{name: "decimal hours", input: "1.5h", expected: time.Date(2026, 3, 31, 14, 0, 0, 0, time.UTC)},
+		{name: "date", input: "2024-06-01", expected: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "rfc3339", input: "2024-06-01T12:00:00+02:00", expected: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)},
+		{name: "today", input: "today", expected: time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{name: "yesterday", input: "yesterday", expected: time.Date(2026, 3, 30, 0, 0, 0, 0, time.UTC)},
+		{name: "last monday", input: "last monday", expected: time.Date(2026, 3, 30, 0, 0, 0, 0, time.UTC)},
+		{name: "last tuesday is a week ago", input: "Last Tuesday", expected: time.Date(2026, 3, 24, 0, 0, 0, 0, time.UTC)},
+		{name: "fractional months", input: "1.5M", wantErr: true},
+		{name: "fractional days", input: "1.5d", expected: time.Date(2026, 3, 30, 3, 30, 0, 0, time.UTC)},
+		{name: "fractional weeks", input: "0.5w", expected: time.Date(2026, 3, 28, 3, 30, 0, 0, time.UTC)},
+		{name: "invalid unit", input: "10x", wantErr: true},
+		{name: "missing unit", input: "10", wantErr: true},
+		{name: "invalid weekday", input: "last funday", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCutoff(tt.input, ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCutoff() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !got.Equal(tt.expected) {
+				t.Errorf("ParseCutoff() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package duration
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatRelative is the single-unit RelativeAge, e.g. "1w".
+	FormatRelative = "relative"
+	// FormatPrecise uses two units, e.g. "1w6d".
+	FormatPrecise = "precise"
+	// FormatHours is the age in whole hours, e.g. "318h".
+	FormatHours = "hours"
+	// FormatAbsolute is the timestamp itself in the chosen time zone.
+	FormatAbsolute = "absolute"
+)
+
+var Formats = []string{FormatRelative, FormatPrecise, FormatHours, FormatAbsolute}
+
+const absoluteLayout = "2006-01-02 15:04 MST"
+
+// Format renders ages for table output. The zero value behaves like
+// RelativeAge.
+type Format struct {
+	Style    string
+	Location *time.Location
+}
+
+// NewFormat validates style and loads zone, an IANA name such as
+// "Europe/Berlin". An empty zone means the local time zone.
+func NewFormat(style, zone string) (Format, error) {
+	valid := false
+	for _, f := range Formats {
+		if f == style {
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return Format{}, fmt.Errorf("invalid time format %q, must be one of %s", style, strings.Join(Formats, ", "))
+	}
+
+	loc := time.Local
+	if zone != "" {
+		var err error
+
+		loc, err = time.LoadLocation(zone)
+		if err != nil {
+			return Format{}, fmt.Errorf("invalid time zone %q: %w", zone, err)
+		}
+	}
+
+	return Format{Style: style, Location: loc}, nil
+}
+
+// Age renders the age of t as of now.
+func (f Format) Age(t, now time.Time) string {
+	switch f.Style {
+	case FormatPrecise:
+		return PreciseAge(now.Sub(t))
+	case FormatHours:
+		return fmt.Sprintf("%dh", int(now.Sub(t).Hours()))
+	case FormatAbsolute:
+		loc := f.Location
+		if loc == nil {
+			loc = time.Local
+		}
+		return t.In(loc).Format(absoluteLayout)
+	default:
+		return RelativeAge(now.Sub(t))
+	}
+}
+
+// Width is the column width that fits most values rendered by f.
+func (f Format) Width() int {
+	switch f.Style {
+	case FormatPrecise, FormatHours:
+		return 6
+	case FormatAbsolute:
+		return len(absoluteLayout) + 2
+	default:
+		return 5
+	}
+}
+
+var units = []struct {
+	suffix string
+	size   time.Duration
+}{
+	{"y", 365 * 24 * time.Hour},
+	{"M", 30 * 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+}
+
+// PreciseAge is RelativeAge with the remainder in the next smaller unit, so
+// 13 days is "1w6d" rather than "1w". A zero remainder is left out.
+func PreciseAge(duration time.Duration) string {
+	for i, u := range units {
+		if duration < u.size && u.suffix != "s" {
+			continue
+		}
+
+		s := fmt.Sprintf("%d%s", int(duration/u.size), u.suffix)
+
+		if i+1 < len(units) {
+			next := units[i+1]
+			if rest := int((duration % u.size) / next.size); rest > 0 {
+				s += fmt.Sprintf("%d%s", rest, next.suffix)
+			}
+		}
+
+		return s
+	}
+
+	return "0s"
+}
@@ -0,0 +1,66 @@
+package duration
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPreciseAge(t *testing.T) {
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name     string
+		input    time.Duration
+		expected string
+	}{
+		{name: "seconds", input: 30 * time.Second, expected: "30s"},
+		{name: "minutes and seconds", input: 15*time.Minute + 5*time.Second, expected: "15m5s"},
+		{name: "days and hours", input: 3*day + 4*time.Hour, expected: "3d4h"},
+		{name: "weeks and days", input: 13 * day, expected: "1w6d"},
+		{name: "whole weeks", input: 14 * day, expected: "2w"},
+		{name: "months and weeks", input: 45 * day, expected: "1M2w"},
+		{name: "years and months", input: 400 * day, expected: "1y1M"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PreciseAge(tt.input); got != tt.expected {
+				t.Errorf("PreciseAge() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-(13*24 + 6) * time.Hour)
+
+	tests := []struct {
+		style    string
+		zone     string
+		expected string
+	}{
+		{style: FormatRelative, expected: "1w"},
+		{style: FormatPrecise, expected: "1w6d"},
+		{style: FormatHours, expected: "318h"},
+		{style: FormatAbsolute, zone: "UTC", expected: "2026-10-01 06:00 UTC"},
+		{style: FormatAbsolute, zone: "Asia/Tokyo", expected: "2026-10-01 15:00 JST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.style+tt.zone, func(t *testing.T) {
+			f, err := NewFormat(tt.style, tt.zone)
+			if err != nil {
+				t.Fatalf("NewFormat() error = %v", err)
+			}
+
+			if got := f.Age(created, now); got != tt.expected {
+				t.Errorf("Age() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := NewFormat("fuzzy", ""); err == nil {
+		t.Error("NewFormat() error = nil, want invalid format error")
+	}
+}
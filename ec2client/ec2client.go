@@ -0,0 +1,132 @@
+package ec2client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/spf13/viper"
+	"github.com/taylormonacelli/lemondrop"
+)
+
+// New returns an EC2 client for region using the default credential chain.
+// The endpoint-url, use-fips and use-dualstack settings apply to every client.
+func New(ctx context.Context, region string) (*ec2.Client, error) {
+	endpoint := viper.GetString("endpoint-url")
+	fips := viper.GetBool("use-fips")
+
+	if endpoint != "" && fips {
+		return nil, errors.New("use-fips cannot be combined with endpoint-url, put the FIPS endpoint in endpoint-url instead")
+	}
+
+	loadOptions := []func(*config.LoadOptions) error{config.WithRegion(region)}
+
+	if fips {
+		loadOptions = append(loadOptions, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+
+	if viper.GetBool("use-dualstack") {
+		loadOptions = append(loadOptions, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.APIOptions = append(cfg.APIOptions, metricsMiddleware(region))
+
+	return ec2.NewFromConfig(cfg, func(o *ec2.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	}), nil
+}
+
+// Regions returns the regions to work on. A static "regions" list wins; with
+// a custom endpoint-url, use-fips or use-dualstack the regions are asked for
+// through DescribeRegions on a client from New, so discovery goes through the
+// same endpoints as the rest of the run; otherwise lemondrop discovers them.
+func Regions(ctx context.Context) ([]string, error) {
+	if regions := viper.GetStringSlice("regions"); len(regions) > 0 {
+		return regions, nil
+	}
+
+	if viper.GetString("endpoint-url") != "" || viper.GetBool("use-fips") || viper.GetBool("use-dualstack") {
+		return describeRegions(ctx)
+	}
+
+	regionDetails, err := lemondrop.GetRegionDetails()
+	if err != nil {
+		return nil, fmt.Errorf("error getting region details: %w", err)
+	}
+
+	regions := make([]string, 0, len(regionDetails))
+	for _, rd := range regionDetails {
+		regions = append(regions, rd.Region)
+	}
+
+	sort.Strings(regions)
+
+	return regions, nil
+}
+
+// EnabledRegions returns the regions the account can use: a static
+// "regions" list, else the regions DescribeRegions reports as enabled, which
+// leaves out opt-in regions the account has not opted in to.
+func EnabledRegions(ctx context.Context) ([]string, error) {
+	if regions := viper.GetStringSlice("regions"); len(regions) > 0 {
+		return regions, nil
+	}
+
+	regions, err := describeRegions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(regions)
+
+	return regions, nil
+}
+
+func describeRegions(ctx context.Context) ([]string, error) {
+	region := viper.GetString("region")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	client, err := New(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+
+	callCtx, cancel := CallContext(ctx)
+	defer cancel()
+
+	result, err := client.DescribeRegions(callCtx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("error describing regions: %w", err)
+	}
+
+	regions := make([]string, 0, len(result.Regions))
+	for _, r := range result.Regions {
+		regions = append(regions, aws.ToString(r.RegionName))
+	}
+
+	return regions, nil
+}
+
+// CallContext bounds a single API call by the configured call-timeout. A zero
+// timeout leaves ctx untouched.
+func CallContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := viper.GetDuration("call-timeout")
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,78 @@
+package ec2client
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gkwa/fragiledonkey/ec2stub"
+	"github.com/spf13/viper"
+)
+
+func TestRegions(t *testing.T) {
+	f, err := ec2stub.ParseFixture([]byte("regions: [us-west-2, eu-central-1]\n"))
+	if err != nil {
+		t.Fatalf("ParseFixture() error = %v", err)
+	}
+
+	server := httptest.NewServer(ec2stub.New(f))
+	defer server.Close()
+
+	for k, v := range ec2stub.Environment("") {
+		t.Setenv(k, v)
+	}
+
+	defer viper.Reset()
+
+	ctx := context.Background()
+
+	viper.Set("endpoint-url", server.URL)
+
+	regions, err := Regions(ctx)
+	if err != nil {
+		t.Fatalf("Regions() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(regions, []string{"us-west-2", "eu-central-1"}) {
+		t.Errorf("Regions() from endpoint = %v", regions)
+	}
+
+	viper.Set("regions", []string{"ap-south-1"})
+
+	regions, err = Regions(ctx)
+	if err != nil {
+		t.Fatalf("Regions() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(regions, []string{"ap-south-1"}) {
+		t.Errorf("Regions() with static list = %v", regions)
+	}
+}
+
+func TestNewRejectsFIPSWithEndpoint(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set("endpoint-url", "http://localhost:4566")
+	viper.Set("use-fips", true)
+
+	if _, err := New(context.Background(), "us-east-1"); err == nil {
+		t.Error("New() error = nil, want error for use-fips with endpoint-url")
+	}
+}
+
+func TestEnabledRegions(t *testing.T) {
+	ec2stub.Start(t, `
+regions: [us-west-2, ap-east-1, eu-central-1]
+not_opted_in: [ap-east-1]
+`)
+
+	regions, err := EnabledRegions(context.Background())
+	if err != nil {
+		t.Fatalf("EnabledRegions() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(regions, []string{"eu-central-1", "us-west-2"}) {
+		t.Errorf("EnabledRegions() = %v, want eu-central-1 and us-west-2", regions)
+	}
+}
@@ -0,0 +1,40 @@
+package ec2client
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/gkwa/fragiledonkey/metrics"
+)
+
+// metricsMiddleware records call latency, including retries, and every attempt
+// that was throttled.
+func metricsMiddleware(region string) func(*middleware.Stack) error {
+	throttles := retry.IsErrorThrottles(retry.DefaultThrottles)
+
+	return func(stack *middleware.Stack) error {
+		err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FragiledonkeyLatency",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				start := time.Now()
+				out, md, err := next.HandleInitialize(ctx, in)
+				metrics.ObserveAPICall(region, awsmiddleware.GetOperationName(ctx), time.Since(start))
+				return out, md, err
+			}), middleware.Before)
+		if err != nil {
+			return err
+		}
+
+		return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("FragiledonkeyThrottles",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				out, md, err := next.HandleFinalize(ctx, in)
+				if err != nil && throttles.IsErrorThrottle(err) == aws.TrueTernary {
+					metrics.APIThrottles.WithLabelValues(region, awsmiddleware.GetOperationName(ctx)).Inc()
+				}
+				return out, md, err
+			}), "Retry", middleware.After)
+	}
+}
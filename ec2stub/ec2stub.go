@@ -0,0 +1,712 @@
+// Package ec2stub is a stand-in for the subset of the EC2 Query API that
+// fragiledonkey calls, backed by a YAML fixture. Real SDK clients reach it
+// through a custom endpoint, which lets query and cleanup run end to end
+// without AWS.
+package ec2stub
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/pattern"
+)
+
+// OwnerID is reported as the owner of every image and snapshot.
+const OwnerID = "123456789012"
+
+const requestID = "00000000-0000-0000-0000-000000000000"
+
+var instanceStateCodes = map[string]int{
+	"pending":       0,
+	"running":       16,
+	"shutting-down": 32,
+	"terminated":    48,
+	"stopping":      64,
+	"stopped":       80,
+}
+
+// credentialRegion extracts the signing region from a SigV4 Authorization
+// header: Credential=AKID/20261018/us-west-2/ec2/aws4_request.
+var credentialRegion = regexp.MustCompile(`Credential=[^/]+/[^/]+/([^/]+)/`)
+
+type Server struct {
+	mu      sync.Mutex
+	fixture *Fixture
+	calls   []string
+	// tokens maps CopyImage client tokens to the image they created.
+	tokens map[string]string
+	nextID int
+}
+
+func New(f *Fixture) *Server {
+	return &Server{fixture: f, tokens: make(map[string]string)}
+}
+
+// Environment returns the variables that point clients built by
+// config.LoadDefaultConfig at url with static credentials and no shared
+// config, for use with t.Setenv.
+func Environment(url string) map[string]string {
+	return map[string]string{
+		"AWS_ENDPOINT_URL_EC2":        url,
+		"AWS_ACCESS_KEY_ID":           "AKIDSTUB",
+		"AWS_SECRET_ACCESS_KEY":       "stub",
+		"AWS_SESSION_TOKEN":           "",
+		"AWS_PROFILE":                 "",
+		"AWS_CONFIG_FILE":             "/dev/null",
+		"AWS_SHARED_CREDENTIALS_FILE": "/dev/null",
+		"AWS_EC2_METADATA_DISABLED":   "true",
+		"AWS_MAX_ATTEMPTS":            "1",
+	}
+}
+
+// Calls returns the actions served so far as "region:Action".
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.calls...)
+}
+
+// Images returns the images currently registered in region.
+func (s *Server) Images(region string) []Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var images []Image
+	for _, image := range s.fixture.Images {
+		if image.Region == region {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// Snapshots returns the snapshots currently present in region.
+func (s *Server) Snapshots(region string) []Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var snapshots []Snapshot
+	for _, snapshot := range s.fixture.Snapshots {
+		if snapshot.Region == region {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots
+}
+
+// SetImageState moves an image to state, as a copy failing or an image being
+// disabled would.
+func (s *Server) SetImageState(region, id, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if image := s.image(region, id); image != nil {
+		image.State = state
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedQueryString", err.Error())
+		return
+	}
+
+	region := "us-east-1"
+	if m := credentialRegion.FindStringSubmatch(r.Header.Get("Authorization")); m != nil {
+		region = m[1]
+	}
+
+	action := r.Form.Get("Action")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, region+":"+action)
+	slog.Debug("ec2stub request", "region", region, "action", action)
+
+	var (
+		response any
+		err      *apiError
+	)
+
+	if slices.Contains(s.fixture.NotOptedIn, region) {
+		writeError(w, http.StatusUnauthorized, "AuthFailure", "AWS was not able to validate the provided access credentials")
+		return
+	}
+
+	if slices.Contains(s.fixture.Denied[region], action) {
+		writeError(w, http.StatusForbidden, "UnauthorizedOperation", "You are not authorized to perform this operation.")
+		return
+	}
+
+	switch action {
+	case "DescribeImages":
+		response, err = s.describeImages(region, r)
+	case "DescribeSnapshots":
+		response, err = s.describeSnapshots(region, r)
+	case "DescribeInstances":
+		response, err = s.describeInstances(region, r)
+	case "DescribeRegions":
+		response = s.describeRegions(r)
+	case "DeregisterImage":
+		response, err = s.deregisterImage(region, r)
+	case "DeleteSnapshot":
+		response, err = s.deleteSnapshot(region, r)
+	case "CopyImage":
+		response, err = s.copyImage(region, r)
+	case "DescribeImageAttribute":
+		response, err = s.describeImageAttribute(region, r)
+	case "DescribeSnapshotAttribute":
+		response, err = s.describeSnapshotAttribute(region, r)
+	case "ModifyImageAttribute":
+		response, err = s.modifyImageAttribute(region, r)
+	case "ModifySnapshotAttribute":
+		response, err = s.modifySnapshotAttribute(region, r)
+	case "GetImageBlockPublicAccessState":
+		response = getImageBlockPublicAccessStateResponse{RequestID: requestID, State: s.blockPublicAccess(region).Image, ManagedBy: "account"}
+	case "GetSnapshotBlockPublicAccessState":
+		response = getSnapshotBlockPublicAccessStateResponse{RequestID: requestID, State: s.blockPublicAccess(region).Snapshot, ManagedBy: "account"}
+	default:
+		err = &apiError{"InvalidAction", fmt.Sprintf("The action %s is not valid for this web service.", action)}
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.code, err.message)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+	if err := xml.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("ec2stub error writing response", "action", action, "error", err)
+	}
+}
+
+type apiError struct {
+	code    string
+	message string
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	var resp errorResponse
+	resp.RequestID = requestID
+	resp.Errors = append(resp.Errors, struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}{code, message})
+
+	w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(resp)
+}
+
+// filters parses Filter.N.Name and Filter.N.Value.M parameters.
+func filters(r *http.Request) map[string][]string {
+	out := make(map[string][]string)
+
+	for i := 1; ; i++ {
+		name := r.Form.Get(fmt.Sprintf("Filter.%d.Name", i))
+		if name == "" {
+			return out
+		}
+
+		for j := 1; ; j++ {
+			value, ok := r.Form[fmt.Sprintf("Filter.%d.Value.%d", i, j)]
+			if !ok {
+				break
+			}
+			out[name] = append(out[name], value...)
+		}
+	}
+}
+
+// list parses numbered parameters such as ImageId.1, ImageId.2.
+func list(r *http.Request, prefix string) []string {
+	var out []string
+
+	for i := 1; ; i++ {
+		value, ok := r.Form[prefix+"."+strconv.Itoa(i)]
+		if !ok {
+			return out
+		}
+		out = append(out, value...)
+	}
+}
+
+// tagSpecifications parses TagSpecification.N.Tag.M parameters into the tags
+// given for resourceType.
+func tagSpecifications(r *http.Request, resourceType string) map[string]string {
+	tags := make(map[string]string)
+
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("TagSpecification.%d.", i)
+		kind := r.Form.Get(prefix + "ResourceType")
+		if kind == "" {
+			return tags
+		}
+		if kind != resourceType {
+			continue
+		}
+
+		for j := 1; ; j++ {
+			key, ok := r.Form[fmt.Sprintf("%sTag.%d.Key", prefix, j)]
+			if !ok {
+				break
+			}
+			tags[key[0]] = r.Form.Get(fmt.Sprintf("%sTag.%d.Value", prefix, j))
+		}
+	}
+}
+
+// match applies EC2 filter semantics: every filter must match, and a filter
+// matches when any of its values does. Values may contain * and ? wildcards.
+// tag:<key> filters match against tags and never match a missing tag.
+func match(fs map[string][]string, fields, tags map[string]string) (bool, *apiError) {
+	for name, values := range fs {
+		field, ok := fields[name]
+		if key, isTag := strings.CutPrefix(name, "tag:"); isTag {
+			field, ok = tags[key]
+			if !ok {
+				return false, nil
+			}
+		}
+		if !ok {
+			return false, &apiError{"InvalidParameterValue", fmt.Sprintf("The filter '%s' is invalid", name)}
+		}
+
+		if !pattern.MatchAny(values, field) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) describeImages(region string, r *http.Request) (any, *apiError) {
+	fs := filters(r)
+	ids := list(r, "ImageId")
+
+	resp := describeImagesResponse{RequestID: requestID}
+
+	for _, image := range s.fixture.Images {
+		if image.Region != region || (len(ids) > 0 && !contains(ids, image.ID)) {
+			continue
+		}
+
+		ok, err := match(fs, map[string]string{
+			"name":      image.Name,
+			"state":     image.State,
+			"image-id":  image.ID,
+			"is-public": strconv.FormatBool(image.public()),
+		}, image.Tags)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		item := imageXML{
+			ImageID:      image.ID,
+			Name:         image.Name,
+			State:        image.State,
+			CreationDate: image.CreationDate.UTC().Format(time.RFC3339),
+			Public:       image.public(),
+			OwnerID:      OwnerID,
+		}
+
+		keys := make([]string, 0, len(image.Tags))
+		for k := range image.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			item.Tags = append(item.Tags, tagXML{Key: k, Value: image.Tags[k]})
+		}
+
+		for i, id := range image.Snapshots {
+			device := blockDeviceXML{DeviceName: fmt.Sprintf("/dev/sd%c", 'a'+i), Ebs: ebsXML{SnapshotID: id}}
+			if snapshot := s.snapshot(region, id); snapshot != nil {
+				device.Ebs.VolumeSize = snapshot.VolumeSize
+			}
+			item.BlockDevices = append(item.BlockDevices, device)
+		}
+
+		resp.Images = append(resp.Images, item)
+	}
+
+	return resp, nil
+}
+
+func (s *Server) describeSnapshots(region string, r *http.Request) (any, *apiError) {
+	fs := filters(r)
+	ids := list(r, "SnapshotId")
+
+	resp := describeSnapshotsResponse{RequestID: requestID}
+
+	for _, snapshot := range s.fixture.Snapshots {
+		if snapshot.Region != region || (len(ids) > 0 && !contains(ids, snapshot.ID)) {
+			continue
+		}
+
+		ok, err := match(fs, map[string]string{
+			"description": snapshot.Description,
+			"snapshot-id": snapshot.ID,
+			"status":      snapshot.State,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		resp.Snapshots = append(resp.Snapshots, snapshotXML{
+			SnapshotID:  snapshot.ID,
+			State:       snapshot.State,
+			Progress:    snapshot.Progress,
+			StartTime:   snapshot.StartTime.UTC().Format(time.RFC3339),
+			Description: snapshot.Description,
+			VolumeSize:  snapshot.VolumeSize,
+			OwnerID:     OwnerID,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *Server) describeInstances(region string, r *http.Request) (any, *apiError) {
+	fs := filters(r)
+	ids := list(r, "InstanceId")
+
+	resp := describeInstancesResponse{RequestID: requestID}
+
+	for _, instance := range s.fixture.Instances {
+		if instance.Region != region || (len(ids) > 0 && !contains(ids, instance.ID)) {
+			continue
+		}
+
+		ok, err := match(fs, map[string]string{
+			"image-id":            instance.ImageID,
+			"instance-id":         instance.ID,
+			"instance-state-name": instance.State,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		// One reservation per instance keeps the response simple; callers
+		// have to walk every reservation anyway.
+		resp.Reservations = append(resp.Reservations, reservationXML{
+			ReservationID: "r-" + instance.ID,
+			Instances: []instanceXML{{
+				InstanceID: instance.ID,
+				ImageID:    instance.ImageID,
+				State:      instanceStateXML{Code: instanceStateCodes[instance.State], Name: instance.State},
+			}},
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *Server) describeRegions(r *http.Request) any {
+	resp := describeRegionsResponse{RequestID: requestID}
+
+	all := r.Form.Get("AllRegions") == "true"
+
+	for _, region := range s.fixture.Regions {
+		status := "opt-in-not-required"
+		if slices.Contains(s.fixture.NotOptedIn, region) {
+			if !all {
+				continue
+			}
+			status = "not-opted-in"
+		}
+
+		resp.Regions = append(resp.Regions, regionXML{
+			RegionName:     region,
+			RegionEndpoint: "ec2." + region + ".amazonaws.com",
+			OptInStatus:    status,
+		})
+	}
+
+	return resp
+}
+
+func (s *Server) deregisterImage(region string, r *http.Request) (any, *apiError) {
+	id := r.Form.Get("ImageId")
+
+	for i, image := range s.fixture.Images {
+		if image.Region == region && image.ID == id {
+			s.fixture.Images = append(s.fixture.Images[:i], s.fixture.Images[i+1:]...)
+			return returnResponse{XMLName: xml.Name{Local: "DeregisterImageResponse"}, RequestID: requestID, Return: true}, nil
+		}
+	}
+
+	return nil, &apiError{"InvalidAMIID.NotFound", fmt.Sprintf("The image id '[%s]' does not exist", id)}
+}
+
+func (s *Server) deleteSnapshot(region string, r *http.Request) (any, *apiError) {
+	id := r.Form.Get("SnapshotId")
+
+	for _, image := range s.fixture.Images {
+		if image.Region == region && contains(image.Snapshots, id) {
+			return nil, &apiError{"InvalidSnapshot.InUse", fmt.Sprintf("The snapshot %s is currently in use by %s", id, image.ID)}
+		}
+	}
+
+	for i, snapshot := range s.fixture.Snapshots {
+		if snapshot.Region == region && snapshot.ID == id {
+			s.fixture.Snapshots = append(s.fixture.Snapshots[:i], s.fixture.Snapshots[i+1:]...)
+			return returnResponse{XMLName: xml.Name{Local: "DeleteSnapshotResponse"}, RequestID: requestID, Return: true}, nil
+		}
+	}
+
+	return nil, &apiError{"InvalidSnapshot.NotFound", fmt.Sprintf("The snapshot '%s' does not exist.", id)}
+}
+
+// copyImage copies an image and its snapshots into region. Copies complete
+// immediately, and repeating a client token returns the image it created.
+func (s *Server) copyImage(region string, r *http.Request) (any, *apiError) {
+	sourceID := r.Form.Get("SourceImageId")
+	sourceRegion := r.Form.Get("SourceRegion")
+	name := r.Form.Get("Name")
+	token := r.Form.Get("ClientToken")
+
+	if name == "" {
+		return nil, &apiError{"MissingParameter", "The request must contain the parameter Name"}
+	}
+
+	if id, ok := s.tokens[token]; ok && token != "" {
+		return copyImageResponse{RequestID: requestID, ImageID: id}, nil
+	}
+
+	source := s.image(sourceRegion, sourceID)
+	if source == nil {
+		return nil, &apiError{"InvalidAMIID.NotFound", fmt.Sprintf("The image id '[%s]' does not exist", sourceID)}
+	}
+
+	s.nextID++
+	now := time.Now().UTC()
+
+	image := Image{
+		ID:           fmt.Sprintf("ami-%017x", s.nextID),
+		Name:         name,
+		Region:       region,
+		State:        "available",
+		CreationDate: now,
+		Tags:         tagSpecifications(r, "image"),
+		Encrypted:    r.Form.Get("Encrypted") == "true",
+		KMSKeyID:     r.Form.Get("KmsKeyId"),
+	}
+
+	for _, id := range source.Snapshots {
+		s.nextID++
+		snapshot := Snapshot{
+			ID:          fmt.Sprintf("snap-%017x", s.nextID),
+			Region:      region,
+			State:       "completed",
+			Progress:    "100%",
+			StartTime:   now,
+			Description: fmt.Sprintf("Copied for DestinationAmi %s from SourceAmi %s for SourceSnapshot %s. Task created on %s.", image.ID, sourceID, id, now.Format(time.RFC3339)),
+		}
+		if src := s.snapshot(sourceRegion, id); src != nil {
+			snapshot.VolumeSize = src.VolumeSize
+		}
+
+		s.fixture.Snapshots = append(s.fixture.Snapshots, snapshot)
+		image.Snapshots = append(image.Snapshots, snapshot.ID)
+	}
+
+	s.fixture.Images = append(s.fixture.Images, image)
+
+	if token != "" {
+		s.tokens[token] = image.ID
+	}
+
+	return copyImageResponse{RequestID: requestID, ImageID: image.ID}, nil
+}
+
+// blockPublicAccess returns the states for region with unset ones unblocked.
+func (s *Server) blockPublicAccess(region string) BlockPublicAccess {
+	b := s.fixture.BlockPublicAccess[region]
+	if b.Image == "" {
+		b.Image = "unblocked"
+	}
+	if b.Snapshot == "" {
+		b.Snapshot = "unblocked"
+	}
+	return b
+}
+
+// image returns the image with id in region. s.mu must be held.
+func (s *Server) image(region, id string) *Image {
+	for i := range s.fixture.Images {
+		if s.fixture.Images[i].Region == region && s.fixture.Images[i].ID == id {
+			return &s.fixture.Images[i]
+		}
+	}
+	return nil
+}
+
+func (image Image) public() bool {
+	return image.Public || image.hasGroupAll()
+}
+
+func (image Image) hasGroupAll() bool {
+	return slices.Contains(image.LaunchPermissions, Permission{Group: "all"})
+}
+
+func permissionsXML(permissions []Permission) []permissionXML {
+	out := make([]permissionXML, 0, len(permissions))
+	for _, p := range permissions {
+		out = append(out, permissionXML(p))
+	}
+	return out
+}
+
+// permissionChanges parses <prefix>.Add.N and <prefix>.Remove.N parameters.
+func permissionChanges(r *http.Request, prefix string) (add, remove []Permission) {
+	parse := func(op string) []Permission {
+		var out []Permission
+		for i := 1; ; i++ {
+			item := fmt.Sprintf("%s.%s.%d.", prefix, op, i)
+			p := Permission{
+				Group:                 r.Form.Get(item + "Group"),
+				UserID:                r.Form.Get(item + "UserId"),
+				OrganizationARN:       r.Form.Get(item + "OrganizationArn"),
+				OrganizationalUnitARN: r.Form.Get(item + "OrganizationalUnitArn"),
+			}
+			if p == (Permission{}) {
+				return out
+			}
+			out = append(out, p)
+		}
+	}
+	return parse("Add"), parse("Remove")
+}
+
+// applyPermissionChanges removes and then adds permissions, ignoring
+// duplicates like EC2 does.
+func applyPermissionChanges(permissions, add, remove []Permission) []Permission {
+	var out []Permission
+	for _, p := range permissions {
+		if !slices.Contains(remove, p) {
+			out = append(out, p)
+		}
+	}
+	for _, p := range add {
+		if !slices.Contains(out, p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (s *Server) describeImageAttribute(region string, r *http.Request) (any, *apiError) {
+	id := r.Form.Get("ImageId")
+
+	if attribute := r.Form.Get("Attribute"); attribute != "launchPermission" {
+		return nil, &apiError{"InvalidParameterValue", fmt.Sprintf("Value (%s) for parameter attribute is invalid", attribute)}
+	}
+
+	image := s.image(region, id)
+	if image == nil {
+		return nil, &apiError{"InvalidAMIID.NotFound", fmt.Sprintf("The image id '[%s]' does not exist", id)}
+	}
+
+	permissions := permissionsXML(image.LaunchPermissions)
+	if image.Public && !image.hasGroupAll() {
+		permissions = append(permissions, permissionXML{Group: "all"})
+	}
+
+	return describeImageAttributeResponse{RequestID: requestID, ImageID: id, LaunchPermissions: permissions}, nil
+}
+
+func (s *Server) describeSnapshotAttribute(region string, r *http.Request) (any, *apiError) {
+	id := r.Form.Get("SnapshotId")
+
+	if attribute := r.Form.Get("Attribute"); attribute != "createVolumePermission" {
+		return nil, &apiError{"InvalidParameterValue", fmt.Sprintf("Value (%s) for parameter attribute is invalid", attribute)}
+	}
+
+	snapshot := s.snapshot(region, id)
+	if snapshot == nil {
+		return nil, &apiError{"InvalidSnapshot.NotFound", fmt.Sprintf("The snapshot '%s' does not exist.", id)}
+	}
+
+	return describeSnapshotAttributeResponse{RequestID: requestID, SnapshotID: id, CreateVolumePermissions: permissionsXML(snapshot.CreateVolumePermissions)}, nil
+}
+
+func (s *Server) modifyImageAttribute(region string, r *http.Request) (any, *apiError) {
+	id := r.Form.Get("ImageId")
+
+	image := s.image(region, id)
+	if image == nil {
+		return nil, &apiError{"InvalidAMIID.NotFound", fmt.Sprintf("The image id '[%s]' does not exist", id)}
+	}
+
+	add, remove := permissionChanges(r, "LaunchPermission")
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, &apiError{"MissingParameter", "The request must contain the parameter LaunchPermission"}
+	}
+
+	// Public is the fixture's shorthand for a group all permission.
+	if image.Public && !image.hasGroupAll() {
+		image.LaunchPermissions = append(image.LaunchPermissions, Permission{Group: "all"})
+	}
+	image.Public = false
+	image.LaunchPermissions = applyPermissionChanges(image.LaunchPermissions, add, remove)
+
+	return returnResponse{XMLName: xml.Name{Local: "ModifyImageAttributeResponse"}, RequestID: requestID, Return: true}, nil
+}
+
+func (s *Server) modifySnapshotAttribute(region string, r *http.Request) (any, *apiError) {
+	id := r.Form.Get("SnapshotId")
+
+	snapshot := s.snapshot(region, id)
+	if snapshot == nil {
+		return nil, &apiError{"InvalidSnapshot.NotFound", fmt.Sprintf("The snapshot '%s' does not exist.", id)}
+	}
+
+	add, remove := permissionChanges(r, "CreateVolumePermission")
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, &apiError{"MissingParameter", "The request must contain the parameter CreateVolumePermission"}
+	}
+
+	snapshot.CreateVolumePermissions = applyPermissionChanges(snapshot.CreateVolumePermissions, add, remove)
+
+	return returnResponse{XMLName: xml.Name{Local: "ModifySnapshotAttributeResponse"}, RequestID: requestID, Return: true}, nil
+}
+
+// snapshot returns the snapshot with id in region. s.mu must be held.
+func (s *Server) snapshot(region, id string) *Snapshot {
+	for i := range s.fixture.Snapshots {
+		if s.fixture.Snapshots[i].Region == region && s.fixture.Snapshots[i].ID == id {
+			return &s.fixture.Snapshots[i]
+		}
+	}
+	return nil
+}
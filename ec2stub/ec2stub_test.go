@@ -0,0 +1,163 @@
+package ec2stub
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/gkwa/fragiledonkey/ec2client"
+)
+
+const fixture = `
+regions: [us-west-2, eu-central-1]
+images:
+  - id: ami-1
+    name: northflier-2026-08-01-a
+    region: us-west-2
+    creation_date: 2026-08-01T00:00:00Z
+    tags: {Team: build}
+    snapshots: [snap-1]
+  - id: ami-2
+    name: nginx-2026-08-01-a
+    region: us-west-2
+    creation_date: 2026-08-01T00:00:00Z
+  - id: ami-3
+    name: northflier-2026-08-02-a
+    region: eu-central-1
+    creation_date: 2026-08-02T00:00:00Z
+snapshots:
+  - id: snap-1
+    region: us-west-2
+    description: Created by CreateImage(i-1) for ami-1
+    volume_size: 8
+    start_time: 2026-08-01T00:00:00Z
+instances:
+  - id: i-1
+    region: us-west-2
+    image_id: ami-1
+`
+
+func newClient(t *testing.T, region string) (*Server, *ec2.Client) {
+	t.Helper()
+
+	f, err := ParseFixture([]byte(fixture))
+	if err != nil {
+		t.Fatalf("ParseFixture() error = %v", err)
+	}
+
+	stub := New(f)
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	for k, v := range Environment(server.URL) {
+		t.Setenv(k, v)
+	}
+
+	client, err := ec2client.New(context.Background(), region)
+	if err != nil {
+		t.Fatalf("ec2client.New() error = %v", err)
+	}
+
+	return stub, client
+}
+
+func TestDescribe(t *testing.T) {
+	_, client := newClient(t, "us-west-2")
+	ctx := context.Background()
+
+	images, err := client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Owners:  []string{"self"},
+		Filters: []types.Filter{{Name: aws.String("name"), Values: []string{"northflier-*"}}},
+	})
+	if err != nil {
+		t.Fatalf("DescribeImages() error = %v", err)
+	}
+
+	if len(images.Images) != 1 || aws.ToString(images.Images[0].ImageId) != "ami-1" {
+		t.Fatalf("DescribeImages() = %v, want ami-1 only", images.Images)
+	}
+
+	image := images.Images[0]
+	if image.State != types.ImageStateAvailable || aws.ToString(image.CreationDate) != "2026-08-01T00:00:00Z" {
+		t.Errorf("image state = %s created = %s", image.State, aws.ToString(image.CreationDate))
+	}
+
+	if len(image.Tags) != 1 || aws.ToString(image.Tags[0].Key) != "Team" {
+		t.Errorf("image tags = %v", image.Tags)
+	}
+
+	snapshots, err := client.DescribeSnapshots(ctx, &ec2.DescribeSnapshotsInput{
+		Filters: []types.Filter{{Name: aws.String("description"), Values: []string{"*ami-1*"}}},
+	})
+	if err != nil {
+		t.Fatalf("DescribeSnapshots() error = %v", err)
+	}
+
+	if len(snapshots.Snapshots) != 1 || aws.ToInt32(snapshots.Snapshots[0].VolumeSize) != 8 {
+		t.Errorf("DescribeSnapshots() = %v", snapshots.Snapshots)
+	}
+
+	instances, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{{Name: aws.String("image-id"), Values: []string{"ami-1"}}},
+	})
+	if err != nil {
+		t.Fatalf("DescribeInstances() error = %v", err)
+	}
+
+	if len(instances.Reservations) != 1 || aws.ToString(instances.Reservations[0].Instances[0].InstanceId) != "i-1" {
+		t.Errorf("DescribeInstances() = %v", instances.Reservations)
+	}
+
+	regions, err := client.DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		t.Fatalf("DescribeRegions() error = %v", err)
+	}
+
+	if len(regions.Regions) != 2 {
+		t.Errorf("DescribeRegions() = %v", regions.Regions)
+	}
+
+	_, err = client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Filters: []types.Filter{{Name: aws.String("bogus"), Values: []string{"x"}}},
+	})
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvalidParameterValue" {
+		t.Errorf("DescribeImages() with unknown filter error = %v, want InvalidParameterValue", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	stub, client := newClient(t, "us-west-2")
+	ctx := context.Background()
+
+	_, err := client.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{SnapshotId: aws.String("snap-1")})
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvalidSnapshot.InUse" {
+		t.Fatalf("DeleteSnapshot() of a registered image's snapshot error = %v, want InvalidSnapshot.InUse", err)
+	}
+
+	if _, err := client.DeregisterImage(ctx, &ec2.DeregisterImageInput{ImageId: aws.String("ami-1")}); err != nil {
+		t.Fatalf("DeregisterImage() error = %v", err)
+	}
+
+	if _, err := client.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{SnapshotId: aws.String("snap-1")}); err != nil {
+		t.Fatalf("DeleteSnapshot() error = %v", err)
+	}
+
+	if len(stub.Images("us-west-2")) != 1 || len(stub.Snapshots("us-west-2")) != 0 {
+		t.Errorf("after deletion images = %v snapshots = %v", stub.Images("us-west-2"), stub.Snapshots("us-west-2"))
+	}
+
+	// The image in eu-central-1 is out of reach of a us-west-2 client.
+	_, err = client.DeregisterImage(ctx, &ec2.DeregisterImageInput{ImageId: aws.String("ami-3")})
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvalidAMIID.NotFound" {
+		t.Errorf("DeregisterImage() in another region error = %v, want InvalidAMIID.NotFound", err)
+	}
+}
@@ -0,0 +1,141 @@
+package ec2stub
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Fixture is the account state the stand-in serves. Every resource belongs to
+// a region and is owned by the caller.
+//
+//	regions: [us-west-2, eu-central-1]
+//	images:
+//	  - id: ami-1
+//	    name: northflier-2026-08-01-a
+//	    region: us-west-2
+//	    creation_date: 2026-08-01T00:00:00Z
+//	    snapshots: [snap-1]
+//	snapshots:
+//	  - id: snap-1
+//	    region: us-west-2
+//	    description: Created by CreateImage(i-1) for ami-1
+//	    volume_size: 8
+//	instances:
+//	  - id: i-1
+//	    region: us-west-2
+//	    image_id: ami-1
+//	block_public_access:
+//	  us-west-2: {image: block-new-sharing, snapshot: block-all-sharing}
+//	denied:
+//	  eu-central-1: [DescribeImages]
+//	not_opted_in: [ap-east-1]
+type Fixture struct {
+	Regions   []string   `yaml:"regions"`
+	Images    []Image    `yaml:"images"`
+	Snapshots []Snapshot `yaml:"snapshots"`
+	Instances []Instance `yaml:"instances"`
+	// BlockPublicAccess is keyed by region; regions left out are unblocked.
+	BlockPublicAccess map[string]BlockPublicAccess `yaml:"block_public_access"`
+	// Denied lists per region the actions answered with UnauthorizedOperation.
+	Denied map[string][]string `yaml:"denied"`
+	// NotOptedIn are opt-in regions the account has not opted in to. Like
+	// EC2, every call there fails with 401 AuthFailure and DescribeRegions
+	// only lists them when asked for all regions.
+	NotOptedIn []string `yaml:"not_opted_in"`
+}
+
+// BlockPublicAccess holds the account's block public access states in a
+// region, e.g. block-new-sharing.
+type BlockPublicAccess struct {
+	Image    string `yaml:"image"`
+	Snapshot string `yaml:"snapshot"`
+}
+
+type Image struct {
+	ID           string            `yaml:"id"`
+	Name         string            `yaml:"name"`
+	Region       string            `yaml:"region"`
+	State        string            `yaml:"state"`
+	CreationDate time.Time         `yaml:"creation_date"`
+	Public       bool              `yaml:"public"`
+	Tags         map[string]string `yaml:"tags"`
+	Encrypted    bool              `yaml:"encrypted"`
+	KMSKeyID     string            `yaml:"kms_key_id"`
+	// LaunchPermissions with group all make the image public, as does Public.
+	LaunchPermissions []Permission `yaml:"launch_permissions"`
+	// Snapshots backs the image; DeleteSnapshot refuses them while the image
+	// is registered, like EC2 does.
+	Snapshots []string `yaml:"snapshots"`
+}
+
+type Snapshot struct {
+	ID          string    `yaml:"id"`
+	Region      string    `yaml:"region"`
+	State       string    `yaml:"state"`
+	Progress    string    `yaml:"progress"`
+	StartTime   time.Time `yaml:"start_time"`
+	Description string    `yaml:"description"`
+	VolumeSize  int32     `yaml:"volume_size"`
+	// CreateVolumePermissions only use Group and UserID.
+	CreateVolumePermissions []Permission `yaml:"create_volume_permissions"`
+}
+
+// Permission is a launch or create volume permission. Exactly one field is
+// set.
+type Permission struct {
+	Group                 string `yaml:"group"`
+	UserID                string `yaml:"user_id"`
+	OrganizationARN       string `yaml:"organization_arn"`
+	OrganizationalUnitARN string `yaml:"organizational_unit_arn"`
+}
+
+type Instance struct {
+	ID      string `yaml:"id"`
+	Region  string `yaml:"region"`
+	ImageID string `yaml:"image_id"`
+	State   string `yaml:"state"`
+}
+
+// ParseFixture reads a YAML fixture and fills in defaults: images are
+// available, snapshots completed and instances running.
+func ParseFixture(data []byte) (*Fixture, error) {
+	var f Fixture
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("error parsing fixture: %w", err)
+	}
+
+	for i := range f.Images {
+		if f.Images[i].State == "" {
+			f.Images[i].State = "available"
+		}
+	}
+
+	for i := range f.Snapshots {
+		if f.Snapshots[i].State == "" {
+			f.Snapshots[i].State = "completed"
+		}
+		if f.Snapshots[i].Progress == "" && f.Snapshots[i].State == "completed" {
+			f.Snapshots[i].Progress = "100%"
+		}
+	}
+
+	for i := range f.Instances {
+		if f.Instances[i].State == "" {
+			f.Instances[i].State = "running"
+		}
+	}
+
+	return &f, nil
+}
+
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading fixture %s: %w", path, err)
+	}
+
+	return ParseFixture(data)
+}
@@ -0,0 +1,36 @@
+package ec2stub
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Start serves the YAML fixture for the rest of the test and points the AWS
+// SDK at it. With regions, they become the regions the run works on instead
+// of discovering them.
+func Start(t testing.TB, fixture string, regions ...string) *Server {
+	t.Helper()
+
+	f, err := ParseFixture([]byte(fixture))
+	if err != nil {
+		t.Fatalf("ParseFixture() error = %v", err)
+	}
+
+	stub := New(f)
+
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	for k, v := range Environment(server.URL) {
+		t.Setenv(k, v)
+	}
+
+	if len(regions) > 0 {
+		viper.Set("regions", regions)
+		t.Cleanup(viper.Reset)
+	}
+
+	return stub
+}
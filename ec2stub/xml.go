@@ -0,0 +1,144 @@
+package ec2stub
+
+import "encoding/xml"
+
+// The response shapes below carry only the elements fragiledonkey reads.
+// The SDK matches elements by name and ignores the root element's name.
+
+type tagXML struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+}
+
+type ebsXML struct {
+	SnapshotID string `xml:"snapshotId"`
+	VolumeSize int32  `xml:"volumeSize"`
+}
+
+type blockDeviceXML struct {
+	DeviceName string `xml:"deviceName"`
+	Ebs        ebsXML `xml:"ebs"`
+}
+
+type imageXML struct {
+	ImageID      string           `xml:"imageId"`
+	Name         string           `xml:"name"`
+	State        string           `xml:"imageState"`
+	CreationDate string           `xml:"creationDate"`
+	Public       bool             `xml:"isPublic"`
+	OwnerID      string           `xml:"imageOwnerId"`
+	Tags         []tagXML         `xml:"tagSet>item"`
+	BlockDevices []blockDeviceXML `xml:"blockDeviceMapping>item"`
+}
+
+type describeImagesResponse struct {
+	XMLName   xml.Name   `xml:"DescribeImagesResponse"`
+	RequestID string     `xml:"requestId"`
+	Images    []imageXML `xml:"imagesSet>item"`
+}
+
+type snapshotXML struct {
+	SnapshotID  string `xml:"snapshotId"`
+	State       string `xml:"status"`
+	Progress    string `xml:"progress"`
+	StartTime   string `xml:"startTime"`
+	Description string `xml:"description"`
+	VolumeSize  int32  `xml:"volumeSize"`
+	OwnerID     string `xml:"ownerId"`
+}
+
+type describeSnapshotsResponse struct {
+	XMLName   xml.Name      `xml:"DescribeSnapshotsResponse"`
+	RequestID string        `xml:"requestId"`
+	Snapshots []snapshotXML `xml:"snapshotSet>item"`
+}
+
+type instanceStateXML struct {
+	Code int    `xml:"code"`
+	Name string `xml:"name"`
+}
+
+type instanceXML struct {
+	InstanceID string           `xml:"instanceId"`
+	ImageID    string           `xml:"imageId"`
+	State      instanceStateXML `xml:"instanceState"`
+}
+
+type reservationXML struct {
+	ReservationID string        `xml:"reservationId"`
+	Instances     []instanceXML `xml:"instancesSet>item"`
+}
+
+type describeInstancesResponse struct {
+	XMLName      xml.Name         `xml:"DescribeInstancesResponse"`
+	RequestID    string           `xml:"requestId"`
+	Reservations []reservationXML `xml:"reservationSet>item"`
+}
+
+type regionXML struct {
+	RegionName     string `xml:"regionName"`
+	RegionEndpoint string `xml:"regionEndpoint"`
+	OptInStatus    string `xml:"optInStatus"`
+}
+
+type describeRegionsResponse struct {
+	XMLName   xml.Name    `xml:"DescribeRegionsResponse"`
+	RequestID string      `xml:"requestId"`
+	Regions   []regionXML `xml:"regionInfo>item"`
+}
+
+type copyImageResponse struct {
+	XMLName   xml.Name `xml:"CopyImageResponse"`
+	RequestID string   `xml:"requestId"`
+	ImageID   string   `xml:"imageId"`
+}
+
+type permissionXML struct {
+	Group                 string `xml:"group,omitempty"`
+	UserID                string `xml:"userId,omitempty"`
+	OrganizationARN       string `xml:"organizationArn,omitempty"`
+	OrganizationalUnitARN string `xml:"organizationalUnitArn,omitempty"`
+}
+
+type describeImageAttributeResponse struct {
+	XMLName           xml.Name        `xml:"DescribeImageAttributeResponse"`
+	RequestID         string          `xml:"requestId"`
+	ImageID           string          `xml:"imageId"`
+	LaunchPermissions []permissionXML `xml:"launchPermission>item"`
+}
+
+type describeSnapshotAttributeResponse struct {
+	XMLName                 xml.Name        `xml:"DescribeSnapshotAttributeResponse"`
+	RequestID               string          `xml:"requestId"`
+	SnapshotID              string          `xml:"snapshotId"`
+	CreateVolumePermissions []permissionXML `xml:"createVolumePermission>item"`
+}
+
+type getImageBlockPublicAccessStateResponse struct {
+	XMLName   xml.Name `xml:"GetImageBlockPublicAccessStateResponse"`
+	RequestID string   `xml:"requestId"`
+	State     string   `xml:"imageBlockPublicAccessState"`
+	ManagedBy string   `xml:"managedBy"`
+}
+
+type getSnapshotBlockPublicAccessStateResponse struct {
+	XMLName   xml.Name `xml:"GetSnapshotBlockPublicAccessStateResponse"`
+	RequestID string   `xml:"requestId"`
+	State     string   `xml:"state"`
+	ManagedBy string   `xml:"managedBy"`
+}
+
+type returnResponse struct {
+	XMLName   xml.Name
+	RequestID string `xml:"requestId"`
+	Return    bool   `xml:"return"`
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Response"`
+	Errors  []struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Errors>Error"`
+	RequestID string `xml:"RequestID"`
+}
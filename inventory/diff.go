@@ -0,0 +1,271 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+// Change describes an AMI that was added, removed or changed between two
+// inventories. Snapshot changes are reported as details of their AMI.
+type Change struct {
+	Region  string   `json:"region"`
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Details []string `json:"details,omitempty"`
+}
+
+// Skipped is a region left out of a comparison because one of the
+// inventories does not know its AMIs.
+type Skipped struct {
+	Region string `json:"region"`
+	Reason string `json:"reason"`
+}
+
+type Diff struct {
+	Added   []Change  `json:"added"`
+	Removed []Change  `json:"removed"`
+	Changed []Change  `json:"changed"`
+	Skipped []Skipped `json:"skipped,omitempty"`
+}
+
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Compare reports how newer differs from older. AMIs are matched by region
+// and ID. Regions that failed to query, or were not queried, for either
+// inventory are skipped rather than reported as all added or removed.
+func Compare(older, newer *Inventory) Diff {
+	var d Diff
+
+	d.Skipped = skippedRegions(older, newer)
+
+	skip := make(map[string]bool, len(d.Skipped))
+	for _, s := range d.Skipped {
+		skip[s.Region] = true
+	}
+
+	before := index(older, skip)
+	after := index(newer, skip)
+
+	for key, ami := range after {
+		prev, ok := before[key]
+		if !ok {
+			d.Added = append(d.Added, Change{Region: ami.Region, ID: ami.ID, Name: ami.Name, Details: []string{summary(ami)}})
+			continue
+		}
+
+		if details := compareAMI(prev, ami); len(details) > 0 {
+			d.Changed = append(d.Changed, Change{Region: ami.Region, ID: ami.ID, Name: ami.Name, Details: details})
+		}
+	}
+
+	for key, ami := range before {
+		if _, ok := after[key]; !ok {
+			d.Removed = append(d.Removed, Change{Region: ami.Region, ID: ami.ID, Name: ami.Name, Details: []string{summary(ami)}})
+		}
+	}
+
+	for _, changes := range [][]Change{d.Added, d.Removed, d.Changed} {
+		sort.Slice(changes, func(i, j int) bool {
+			if changes[i].Region != changes[j].Region {
+				return changes[i].Region < changes[j].Region
+			}
+			return changes[i].Name < changes[j].Name
+		})
+	}
+
+	return d
+}
+
+func index(inv *Inventory, skip map[string]bool) map[string]query.AMI {
+	m := make(map[string]query.AMI, len(inv.AMIs))
+	for _, ami := range inv.AMIs {
+		if !skip[ami.Region] {
+			m[ami.Region+"/"+ami.ID] = ami
+		}
+	}
+	return m
+}
+
+// skippedRegions returns the regions of either inventory whose AMIs the
+// other one does not know, sorted.
+func skippedRegions(older, newer *Inventory) []Skipped {
+	var regions []string
+
+	for _, inv := range []*Inventory{older, newer} {
+		regions = append(regions, inv.Regions...)
+		regions = append(regions, inv.AMIRegions()...)
+		for region := range inv.FailedRegions {
+			regions = append(regions, region)
+		}
+	}
+
+	sort.Strings(regions)
+
+	var skipped []Skipped
+
+	for _, region := range slices.Compact(regions) {
+		for _, side := range []struct {
+			name string
+			inv  *Inventory
+		}{{"old", older}, {"new", newer}} {
+			if err, ok := side.inv.FailedRegions[region]; ok {
+				skipped = append(skipped, Skipped{Region: region, Reason: fmt.Sprintf("failed to query for the %s inventory: %s", side.name, err)})
+				break
+			}
+
+			if !side.inv.queried(region) {
+				skipped = append(skipped, Skipped{Region: region, Reason: fmt.Sprintf("not queried for the %s inventory", side.name)})
+				break
+			}
+		}
+	}
+
+	return skipped
+}
+
+func summary(ami query.AMI) string {
+	var size int64
+	for _, snapshot := range ami.Snapshots {
+		size += int64(snapshot.VolumeSize)
+	}
+	return fmt.Sprintf("%s, %d snapshots, %d GiB", ami.State, len(ami.Snapshots), size)
+}
+
+func compareAMI(older, newer query.AMI) []string {
+	var details []string
+
+	if older.Name != newer.Name {
+		details = append(details, fmt.Sprintf("name %s -> %s", older.Name, newer.Name))
+	}
+
+	if older.State != newer.State {
+		details = append(details, fmt.Sprintf("state %s -> %s", older.State, newer.State))
+	}
+
+	for _, key := range tagKeys(older.Tags, newer.Tags) {
+		oldValue, hadOld := older.Tags[key]
+		newValue, hasNew := newer.Tags[key]
+
+		switch {
+		case !hadOld:
+			details = append(details, fmt.Sprintf("tag %s added: %s", key, newValue))
+		case !hasNew:
+			details = append(details, fmt.Sprintf("tag %s removed", key))
+		case oldValue != newValue:
+			details = append(details, fmt.Sprintf("tag %s %s -> %s", key, oldValue, newValue))
+		}
+	}
+
+	before := make(map[string]query.Snapshot)
+	for _, snapshot := range older.Snapshots {
+		before[snapshot.ID] = snapshot
+	}
+
+	after := make(map[string]bool)
+
+	for _, snapshot := range newer.Snapshots {
+		after[snapshot.ID] = true
+
+		prev, ok := before[snapshot.ID]
+		switch {
+		case !ok:
+			details = append(details, fmt.Sprintf("snapshot %s added (%d GiB)", snapshot.ID, snapshot.VolumeSize))
+		case prev.State != snapshot.State:
+			details = append(details, fmt.Sprintf("snapshot %s state %s -> %s", snapshot.ID, prev.State, snapshot.State))
+		case prev.VolumeSize != snapshot.VolumeSize:
+			details = append(details, fmt.Sprintf("snapshot %s size %d -> %d GiB", snapshot.ID, prev.VolumeSize, snapshot.VolumeSize))
+		}
+	}
+
+	for _, snapshot := range older.Snapshots {
+		if !after[snapshot.ID] {
+			details = append(details, fmt.Sprintf("snapshot %s removed (%d GiB)", snapshot.ID, snapshot.VolumeSize))
+		}
+	}
+
+	return details
+}
+
+func tagKeys(a, b map[string]string) []string {
+	seen := make(map[string]bool)
+
+	var keys []string
+
+	for _, m := range []map[string]string{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Print writes d grouped by region, using + for added, - for removed and ~
+// for changed AMIs.
+func (d Diff) Print(w io.Writer) {
+	defer d.printSkipped(w)
+
+	if d.Empty() {
+		fmt.Fprintln(w, "No changes.")
+		return
+	}
+
+	byRegion := make(map[string][]string)
+
+	var regions []string
+
+	add := func(marker string, changes []Change) {
+		for _, c := range changes {
+			if _, ok := byRegion[c.Region]; !ok {
+				regions = append(regions, c.Region)
+			}
+
+			line := fmt.Sprintf("  %s %-21s %s", marker, c.ID, c.Name)
+			if marker == "~" {
+				line += "\n      " + strings.Join(c.Details, "\n      ")
+			} else if len(c.Details) > 0 {
+				line += " (" + strings.Join(c.Details, "; ") + ")"
+			}
+
+			byRegion[c.Region] = append(byRegion[c.Region], line)
+		}
+	}
+
+	add("+", d.Added)
+	add("-", d.Removed)
+	add("~", d.Changed)
+
+	sort.Strings(regions)
+
+	for _, region := range regions {
+		fmt.Fprintln(w, region)
+		for _, line := range byRegion[region] {
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+}
+
+func (d Diff) printSkipped(w io.Writer) {
+	if len(d.Skipped) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\nNot compared:")
+	for _, s := range d.Skipped {
+		fmt.Fprintf(w, "  %s %s\n", s.Region, s.Reason)
+	}
+}
@@ -0,0 +1,119 @@
+// Package inventory saves query results to disk and compares them, so changes
+// between runs can be reviewed without calling AWS.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+// Version is bumped when the file format changes incompatibly.
+const Version = 1
+
+type Inventory struct {
+	Version    int       `json:"version"`
+	CapturedAt time.Time `json:"captured_at"`
+	Filter     string    `json:"filter"`
+	// Regions are the regions that were queried, failed or not. Inventories
+	// saved before it was recorded leave it empty.
+	Regions []string `json:"regions,omitempty"`
+	// FailedRegions maps the regions whose AMIs could not be listed to the
+	// error, so their missing AMIs are not read as removed.
+	FailedRegions map[string]string `json:"failed_regions,omitempty"`
+	AMIs          []query.AMI       `json:"amis"`
+}
+
+func New(filter string, capturedAt time.Time, amis []query.AMI) *Inventory {
+	sorted := append([]query.AMI(nil), amis...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Region != sorted[j].Region {
+			return sorted[i].Region < sorted[j].Region
+		}
+		return sorted[i].CreationDate.After(sorted[j].CreationDate)
+	})
+
+	return &Inventory{Version: Version, CapturedAt: capturedAt, Filter: filter, AMIs: sorted}
+}
+
+// FromListing returns the inventory of a query across regions, recording
+// which regions were queried and which failed.
+func FromListing(filter string, capturedAt time.Time, l query.Listing) *Inventory {
+	inv := New(filter, capturedAt, l.AMIs)
+	inv.Regions = l.Regions
+
+	if len(l.Failed) > 0 {
+		inv.FailedRegions = make(map[string]string, len(l.Failed))
+		for region, err := range l.Failed {
+			inv.FailedRegions[region] = err.Error()
+		}
+	}
+
+	return inv
+}
+
+// queried reports whether region was queried successfully. Regions are
+// assumed queried when inv does not record them.
+func (inv *Inventory) queried(region string) bool {
+	if _, ok := inv.FailedRegions[region]; ok {
+		return false
+	}
+
+	return len(inv.Regions) == 0 || slices.Contains(inv.Regions, region)
+}
+
+// AMIRegions returns the regions that have AMIs in inv, sorted.
+func (inv *Inventory) AMIRegions() []string {
+	seen := make(map[string]bool)
+
+	var regions []string
+
+	for _, ami := range inv.AMIs {
+		if !seen[ami.Region] {
+			seen[ami.Region] = true
+			regions = append(regions, ami.Region)
+		}
+	}
+
+	sort.Strings(regions)
+
+	return regions
+}
+
+// Save writes inv to path, replacing any existing file atomically.
+func Save(path string, inv *Inventory) error {
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing inventory %s: %w", path, err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func Load(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading inventory %s: %w", path, err)
+	}
+
+	var inv Inventory
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("error parsing inventory %s: %w", path, err)
+	}
+
+	if inv.Version != Version {
+		return nil, fmt.Errorf("inventory %s has version %d, expected %d", path, inv.Version, Version)
+	}
+
+	return &inv, nil
+}
@@ -0,0 +1,131 @@
+package inventory
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	captured := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	inv := New("northflier-*", captured, []query.AMI{
+		{ID: "ami-2", Region: "us-west-2", State: "available", CreationDate: captured.Add(-time.Hour)},
+		{ID: "ami-1", Region: "eu-central-1", State: "available", CreationDate: captured, Tags: map[string]string{"Team": "build"}},
+	})
+
+	if err := Save(path, inv); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, inv) {
+		t.Errorf("Load() = %+v, want %+v", got, inv)
+	}
+
+	if regions := got.AMIRegions(); !reflect.DeepEqual(regions, []string{"eu-central-1", "us-west-2"}) {
+		t.Errorf("AMIRegions() = %v", regions)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	older := &Inventory{AMIs: []query.AMI{
+		{ID: "ami-kept", Name: "northflier-a", Region: "us-west-2", State: "available", Snapshots: []query.Snapshot{{ID: "snap-1", State: "pending", VolumeSize: 8}}},
+		{ID: "ami-gone", Name: "northflier-b", Region: "us-west-2", State: "available", Snapshots: []query.Snapshot{{ID: "snap-2", State: "completed", VolumeSize: 8}}},
+		{ID: "ami-same", Name: "northflier-c", Region: "eu-central-1", State: "available", Tags: map[string]string{"Team": "build"}},
+	}}
+
+	newer := &Inventory{AMIs: []query.AMI{
+		{ID: "ami-kept", Name: "northflier-a", Region: "us-west-2", State: "available", Tags: map[string]string{"Release": "yes"}, Snapshots: []query.Snapshot{{ID: "snap-1", State: "completed", VolumeSize: 8}}},
+		{ID: "ami-new", Name: "northflier-d", Region: "us-west-2", State: "available", Snapshots: []query.Snapshot{{ID: "snap-3", State: "completed", VolumeSize: 16}}},
+		{ID: "ami-same", Name: "northflier-c", Region: "eu-central-1", State: "available", Tags: map[string]string{"Team": "build"}},
+	}}
+
+	d := Compare(older, newer)
+
+	if len(d.Added) != 1 || d.Added[0].ID != "ami-new" {
+		t.Errorf("Added = %+v, want ami-new", d.Added)
+	}
+
+	if len(d.Removed) != 1 || d.Removed[0].ID != "ami-gone" {
+		t.Errorf("Removed = %+v, want ami-gone", d.Removed)
+	}
+
+	if len(d.Changed) != 1 || d.Changed[0].ID != "ami-kept" {
+		t.Fatalf("Changed = %+v, want ami-kept", d.Changed)
+	}
+
+	expected := []string{"tag Release added: yes", "snapshot snap-1 state pending -> completed"}
+	if !reflect.DeepEqual(d.Changed[0].Details, expected) {
+		t.Errorf("Changed details = %v, want %v", d.Changed[0].Details, expected)
+	}
+
+	var out bytes.Buffer
+	d.Print(&out)
+
+	if !strings.Contains(out.String(), "1 added, 1 removed, 1 changed") {
+		t.Errorf("Print() = %q", out.String())
+	}
+
+	if !Compare(newer, newer).Empty() {
+		t.Error("Compare() of identical inventories is not empty")
+	}
+}
+
+func TestCompareSkipsFailedRegions(t *testing.T) {
+	captured := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	older := FromListing("northflier-*", captured, query.Listing{
+		Regions: []string{"eu-central-1", "us-east-1", "us-west-2"},
+		AMIs: []query.AMI{
+			{ID: "ami-east", Name: "northflier-a", Region: "us-east-1", State: "available"},
+			{ID: "ami-west", Name: "northflier-b", Region: "us-west-2", State: "available"},
+		},
+	})
+
+	newer := FromListing("northflier-*", captured.Add(24*time.Hour), query.Listing{
+		Regions: []string{"eu-central-1", "us-east-1", "us-west-2"},
+		Failed:  map[string]error{"us-east-1": errors.New("api error RequestLimitExceeded")},
+		AMIs: []query.AMI{
+			{ID: "ami-eu", Name: "northflier-c", Region: "eu-central-1", State: "available"},
+		},
+	})
+
+	d := Compare(older, newer)
+
+	if len(d.Removed) != 1 || d.Removed[0].ID != "ami-west" {
+		t.Errorf("Removed = %+v, want only ami-west", d.Removed)
+	}
+
+	if len(d.Added) != 1 || d.Added[0].ID != "ami-eu" {
+		t.Errorf("Added = %+v, want ami-eu", d.Added)
+	}
+
+	if len(d.Skipped) != 1 || d.Skipped[0].Region != "us-east-1" {
+		t.Fatalf("Skipped = %+v, want us-east-1", d.Skipped)
+	}
+
+	var out bytes.Buffer
+	d.Print(&out)
+
+	if !strings.Contains(out.String(), "us-east-1 failed to query for the new inventory: api error RequestLimitExceeded") {
+		t.Errorf("Print() = %q", out.String())
+	}
+
+	// An inventory that did not query a region says nothing about its AMIs.
+	narrow := &Inventory{Regions: []string{"us-west-2"}}
+	if d := Compare(older, narrow); len(d.Removed) != 1 || d.Removed[0].ID != "ami-west" {
+		t.Errorf("Compare() with a narrower inventory Removed = %+v, want only ami-west", d.Removed)
+	}
+}
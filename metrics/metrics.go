@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Registry holds only fragiledonkey metrics so the textfile output does not
+// clash with the Go runtime metrics node_exporter already exposes.
+var Registry = prometheus.NewRegistry()
+
+var (
+	AMIs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fragiledonkey_amis",
+		Help: "Number of AMIs matching the pattern.",
+	}, []string{"region", "pattern"})
+
+	Snapshots = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fragiledonkey_snapshots",
+		Help: "Number of snapshots backing AMIs matching the pattern.",
+	}, []string{"region", "pattern"})
+
+	SnapshotGiB = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fragiledonkey_snapshot_volume_gib",
+		Help: "Total volume size in GiB of snapshots backing AMIs matching the pattern.",
+	}, []string{"region", "pattern"})
+
+	QueryFailed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fragiledonkey_query_failed",
+		Help: "1 if the last query of the region failed and its AMI gauges are stale, else 0.",
+	}, []string{"region"})
+
+	ImagesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fragiledonkey_images_deleted_total",
+		Help: "Number of AMIs deregistered by cleanup.",
+	}, []string{"region"})
+
+	SnapshotsDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fragiledonkey_snapshots_deleted_total",
+		Help: "Number of snapshots deleted by cleanup.",
+	}, []string{"region"})
+
+	DeletionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fragiledonkey_deletion_failures_total",
+		Help: "Number of failed AMI or snapshot deletions.",
+	}, []string{"region", "kind"})
+
+	APICallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fragiledonkey_api_call_duration_seconds",
+		Help:    "Latency of EC2 API calls including retries.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"region", "operation"})
+
+	APIThrottles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fragiledonkey_api_throttles_total",
+		Help: "Number of EC2 API attempts rejected because of throttling.",
+	}, []string{"region", "operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		AMIs,
+		Snapshots,
+		SnapshotGiB,
+		QueryFailed,
+		ImagesDeleted,
+		SnapshotsDeleted,
+		DeletionFailures,
+		APICallDuration,
+		APIThrottles,
+	)
+}
+
+func ObserveAPICall(region, operation string, d time.Duration) {
+	APICallDuration.WithLabelValues(region, operation).Observe(d.Seconds())
+}
+
+func WriteTextfile(path string) error {
+	return prometheus.WriteToTextfile(path, Registry)
+}
@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/cleanup"
+	"github.com/spf13/viper"
+)
+
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+)
+
+// Webhook is an HTTP endpoint receiving run summaries. Template, when set, is
+// a text/template rendered with the cleanup.Report and must produce JSON.
+type Webhook struct {
+	URL      string            `mapstructure:"url"`
+	Format   string            `mapstructure:"format"`
+	Template string            `mapstructure:"template"`
+	Headers  map[string]string `mapstructure:"headers"`
+}
+
+const sendTimeout = 10 * time.Second
+
+const slackText = `fragiledonkey cleanup run {{.RunID}} ({{.Pattern}})
+{{- with .Error}}
+Run failed: {{.}}
+{{- end}}
+{{- range .Regions}}
+{{.Region}}: {{.ImagesDeleted}} AMIs deregistered, {{.SnapshotsDeleted}} snapshots deleted, {{.Failed}} failed, {{.Remaining}} remaining
+{{- end}}
+Reclaimed: {{.ReclaimedGiB}} GiB
+{{- if .Failures}}
+Failures:
+{{- range .Failures}}
+• {{.Region}} {{.Kind}}{{with .ID}} {{.}}{{end}}: {{.Error}}
+{{- end}}
+{{- end}}
+{{- if .KeptInUse}}
+Kept because in use:
+{{- range .KeptInUse}}
+• {{.Region}} {{.ID}} {{.Name}} ({{join .Instances ", "}})
+{{- end}}
+{{- end}}`
+
+var funcs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join": strings.Join,
+}
+
+func render(text string, report cleanup.Report) (string, error) {
+	tmpl, err := template.New("notify").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, report); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// Body renders the request body hook sends for report.
+func Body(hook Webhook, report cleanup.Report) ([]byte, error) {
+	if hook.Template != "" {
+		body, err := render(hook.Template, report)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering template: %w", err)
+		}
+
+		if !json.Valid([]byte(body)) {
+			return nil, errors.New("template did not produce valid JSON")
+		}
+
+		return []byte(body), nil
+	}
+
+	switch hook.Format {
+	case "", FormatJSON:
+		return json.Marshal(report)
+	case FormatSlack:
+		text, err := render(slackText, report)
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(map[string]string{"text": text})
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q", hook.Format)
+	}
+}
+
+func post(ctx context.Context, client *http.Client, hook Webhook, report cleanup.Report) error {
+	body, err := Body(hook, report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Send posts report to every hook and returns the combined errors.
+func Send(ctx context.Context, hooks []Webhook, report cleanup.Report) error {
+	client := &http.Client{Timeout: sendTimeout}
+
+	var errs []error
+
+	for _, hook := range hooks {
+		start := time.Now()
+		if err := post(ctx, client, hook, report); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", hook.URL, err))
+			continue
+		}
+
+		slog.Debug("sent notification", "url", hook.URL, "run_id", report.RunID, "duration_ms", time.Since(start).Milliseconds())
+	}
+
+	return errors.Join(errs...)
+}
+
+// Configured returns the webhooks listed under notify.webhooks.
+func Configured() ([]Webhook, error) {
+	var hooks []Webhook
+	if err := viper.UnmarshalKey("notify.webhooks", &hooks); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// Run sends the summary of run to the configured webhooks. Runs that neither
+// deleted nor kept anything are not reported. Delivery still happens after ctx
+// is cancelled so interrupted runs are reported too.
+func Run(ctx context.Context, run *cleanup.Run) {
+	if run == nil {
+		return
+	}
+
+	report := run.Report()
+	if len(report.Regions) == 0 && len(report.KeptInUse) == 0 {
+		return
+	}
+
+	deliver(ctx, report)
+}
+
+// Failed sends report, from cleanup.FailedReport, to the configured webhooks.
+// Failed runs are always reported.
+func Failed(ctx context.Context, report cleanup.Report) {
+	deliver(ctx, report)
+}
+
+func deliver(ctx context.Context, report cleanup.Report) {
+	hooks, err := Configured()
+	if err != nil {
+		slog.Error("error reading notify config", "error", err)
+		return
+	}
+
+	if len(hooks) == 0 {
+		return
+	}
+
+	if err := Send(context.WithoutCancel(ctx), hooks, report); err != nil {
+		slog.Error("error sending notifications", "run_id", report.RunID, "error", err)
+	}
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gkwa/fragiledonkey/cleanup"
+)
+
+var report = cleanup.Report{
+	RunID:   "20261001T030000Z-abcdef",
+	Pattern: "northflier-*",
+	Regions: []cleanup.RegionSummary{
+		{Region: "us-west-2", ImagesDeleted: 2, SnapshotsDeleted: 2, Failed: 1},
+	},
+	ReclaimedGiB: 16,
+	Failures: []cleanup.Failure{
+		{Region: "us-west-2", Kind: "snapshot", ID: "snap-1", Error: "InvalidSnapshot.InUse"},
+	},
+	KeptInUse: []cleanup.KeptImage{
+		{Region: "us-west-2", ID: "ami-1", Name: "northflier-2026-09-01-1", Instances: []string{"i-1", "i-2"}},
+	},
+}
+
+func TestSend(t *testing.T) {
+	var bodies []string
+
+	var headers []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		headers = append(headers, r.Header.Get("X-Token"))
+	}))
+	defer server.Close()
+
+	hooks := []Webhook{
+		{URL: server.URL, Headers: map[string]string{"X-Token": "secret"}},
+		{URL: server.URL, Format: FormatSlack},
+		{URL: server.URL, Template: `{"run": {{json .RunID}}, "gib": {{.ReclaimedGiB}}}`},
+	}
+
+	if err := Send(context.Background(), hooks, report); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if len(bodies) != 3 {
+		t.Fatalf("got %d requests, want 3", len(bodies))
+	}
+
+	var decoded cleanup.Report
+	if err := json.Unmarshal([]byte(bodies[0]), &decoded); err != nil || decoded.ReclaimedGiB != 16 {
+		t.Errorf("json body = %s, want report with reclaimed_gib 16", bodies[0])
+	}
+
+	if headers[0] != "secret" {
+		t.Errorf("X-Token header = %q, want %q", headers[0], "secret")
+	}
+
+	var slack map[string]string
+	if err := json.Unmarshal([]byte(bodies[1]), &slack); err != nil {
+		t.Fatalf("slack body is not JSON: %v", err)
+	}
+
+	for _, want := range []string{"us-west-2: 2 AMIs deregistered", "Reclaimed: 16 GiB", "snap-1", "ami-1", "i-1, i-2"} {
+		if !strings.Contains(slack["text"], want) {
+			t.Errorf("slack text missing %q:\n%s", want, slack["text"])
+		}
+	}
+
+	if bodies[2] != `{"run": "20261001T030000Z-abcdef", "gib": 16}` {
+		t.Errorf("templated body = %s", bodies[2])
+	}
+}
+
+func TestSendReportsFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := Send(context.Background(), []Webhook{{URL: server.URL}}, report)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Send() error = %v, want status 500 error", err)
+	}
+}
+
+func TestBodyRejectsInvalidTemplateOutput(t *testing.T) {
+	_, err := Body(Webhook{Template: `{"run": {{.RunID}}}`}, report)
+	if err == nil {
+		t.Error("Body() error = nil, want invalid JSON error")
+	}
+}
+
+func TestBodyShowsRunError(t *testing.T) {
+	failed := cleanup.Report{Pattern: "northflier-*", Error: "deleting 60 AMIs exceeds cleanup.limits"}
+
+	body, err := Body(Webhook{Format: FormatSlack}, failed)
+	if err != nil {
+		t.Fatalf("Body() error = %v", err)
+	}
+
+	var slack map[string]string
+	if err := json.Unmarshal(body, &slack); err != nil {
+		t.Fatalf("slack body is not JSON: %v", err)
+	}
+
+	if !strings.Contains(slack["text"], "Run failed: deleting 60 AMIs exceeds cleanup.limits") {
+		t.Errorf("slack text missing the run error:\n%s", slack["text"])
+	}
+}
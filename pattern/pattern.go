@@ -0,0 +1,123 @@
+package pattern
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Lint rejects patterns that would match every self-owned AMI, such as an
+// empty string or one made only of wildcards.
+func Lint(patterns []string) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("no pattern given")
+	}
+
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" {
+			return fmt.Errorf("pattern is empty and would match every image")
+		}
+
+		if strings.Trim(p, "*?") == "" {
+			return fmt.Errorf("pattern %q matches every image name, use --force-pattern if that is intended", p)
+		}
+	}
+
+	return nil
+}
+
+// Match reports whether name matches an EC2 filter wildcard pattern, where
+// "*" matches any sequence of characters and "?" matches exactly one.
+func Match(pattern, name string) bool {
+	p, n := []rune(pattern), []rune(name)
+
+	// star remembers the last "*" so a mismatch can retry it with one more
+	// character consumed.
+	pi, ni, star, mark := 0, 0, -1, 0
+
+	for ni < len(n) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == n[ni]):
+			pi++
+			ni++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ni
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			ni = mark
+		default:
+			return false
+		}
+	}
+
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+
+	return pi == len(p)
+}
+
+// MatchAny reports whether name matches any of patterns.
+func MatchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if Match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prefix returns the family part of an image name: everything before the
+// first digit with trailing separators removed, so "northflier-2026-10-01-a"
+// becomes "northflier".
+func Prefix(name string) string {
+	i := strings.IndexFunc(name, unicode.IsDigit)
+	if i < 0 {
+		return name
+	}
+	return strings.TrimRight(name[:i], "-_. ")
+}
+
+// Prefixes returns the sorted distinct prefixes of names.
+func Prefixes(names []string) []string {
+	seen := make(map[string]bool)
+
+	var prefixes []string
+
+	for _, name := range names {
+		p := Prefix(name)
+		if !seen[p] {
+			seen[p] = true
+			prefixes = append(prefixes, p)
+		}
+	}
+
+	sort.Strings(prefixes)
+
+	return prefixes
+}
+
+// MixedPrefixes returns, for every pattern, the distinct prefixes of the names
+// it matches when there is more than one. Such a pattern most likely spans
+// unrelated image families.
+func MixedPrefixes(patterns, names []string) map[string][]string {
+	mixed := make(map[string][]string)
+
+	for _, p := range patterns {
+		var matched []string
+		for _, name := range names {
+			if Match(p, name) {
+				matched = append(matched, name)
+			}
+		}
+
+		if prefixes := Prefixes(matched); len(prefixes) > 1 {
+			mixed[p] = prefixes
+		}
+	}
+
+	return mixed
+}
@@ -0,0 +1,68 @@
+package pattern
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		wantErr  bool
+	}{
+		{name: "default", patterns: []string{"northflier-????-??-??-*"}, wantErr: false},
+		{name: "none", patterns: nil, wantErr: true},
+		{name: "empty", patterns: []string{""}, wantErr: true},
+		{name: "star", patterns: []string{"*"}, wantErr: true},
+		{name: "wildcards only", patterns: []string{"?*?"}, wantErr: true},
+		{name: "one bad of many", patterns: []string{"northflier-*", "*"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Lint(tt.patterns); (err != nil) != tt.wantErr {
+				t.Errorf("Lint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{pattern: "northflier-????-??-??-*", name: "northflier-2026-10-01-abc", expected: true},
+		{pattern: "northflier-????-??-??-*", name: "northflier-26-10-01-abc", expected: false},
+		{pattern: "*-rc*", name: "northflier-2026-10-01-rc1", expected: true},
+		{pattern: "*-rc*", name: "northflier-2026-10-01", expected: false},
+		{pattern: "*", name: "", expected: true},
+		{pattern: "a*b*c", name: "axxbyyc", expected: true},
+		{pattern: "a*b*c", name: "axxbyy", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := Match(tt.pattern, tt.name); got != tt.expected {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMixedPrefixes(t *testing.T) {
+	names := []string{
+		"northflier-2026-10-01-a",
+		"northflier-2026-10-02-a",
+		"nginx-2026-10-01",
+	}
+
+	got := MixedPrefixes([]string{"n*", "northflier-*"}, names)
+	expected := map[string][]string{"n*": {"nginx", "northflier"}}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("MixedPrefixes() = %v, want %v", got, expected)
+	}
+}
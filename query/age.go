@@ -0,0 +1,117 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	AgeSourceCreation = "creation"
+	AgeSourceName     = "name"
+	AgeSourceTag      = "tag"
+	AgeSourceSnapshot = "snapshot"
+)
+
+var AgeSources = []string{AgeSourceCreation, AgeSourceName, AgeSourceTag, AgeSourceSnapshot}
+
+const (
+	DefaultNameDateLayout = "2006-01-02"
+	DefaultNameDateRegex  = `\d{4}-\d{2}-\d{2}`
+)
+
+// AgeSource decides which timestamp an AMI's age is measured from. Copied
+// AMIs get a fresh CreationDate, so the build date embedded in the name, a
+// tag, or the oldest backing snapshot can be more truthful. The zero value
+// uses CreationDate.
+type AgeSource struct {
+	Kind string
+	// Layout parses the date found in the name or tag value.
+	Layout string
+	// NameRegex extracts the date from the name.
+	NameRegex *regexp.Regexp
+	Tag       string
+}
+
+func NewAgeSource(kind, layout, nameRegex, tag string) (AgeSource, error) {
+	source := AgeSource{Kind: kind, Layout: layout, Tag: tag}
+
+	switch kind {
+	case "", AgeSourceCreation, AgeSourceSnapshot:
+	case AgeSourceName:
+		re, err := regexp.Compile(nameRegex)
+		if err != nil {
+			return AgeSource{}, fmt.Errorf("invalid name date regex: %w", err)
+		}
+		source.NameRegex = re
+	case AgeSourceTag:
+		if tag == "" {
+			return AgeSource{}, fmt.Errorf("age source %q needs a tag key", kind)
+		}
+	default:
+		return AgeSource{}, fmt.Errorf("invalid age source %q, must be one of %s", kind, strings.Join(AgeSources, ", "))
+	}
+
+	return source, nil
+}
+
+// Time returns the timestamp ami's age is measured from.
+func (s AgeSource) Time(ami AMI) (time.Time, error) {
+	switch s.Kind {
+	case AgeSourceName:
+		re := s.NameRegex
+		if re == nil {
+			re = regexp.MustCompile(DefaultNameDateRegex)
+		}
+
+		// Use the first capture group when there is one so the regex can
+		// anchor on surrounding text.
+		m := re.FindStringSubmatch(ami.Name)
+		if m == nil {
+			return time.Time{}, fmt.Errorf("no date found in name %q", ami.Name)
+		}
+
+		value := m[0]
+		if len(m) > 1 {
+			value = m[1]
+		}
+
+		return s.parse(value)
+	case AgeSourceTag:
+		value, ok := ami.Tags[s.Tag]
+		if !ok {
+			return time.Time{}, fmt.Errorf("tag %q not set", s.Tag)
+		}
+
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, nil
+		}
+
+		return s.parse(value)
+	case AgeSourceSnapshot:
+		var oldest time.Time
+		for _, snapshot := range ami.Snapshots {
+			if oldest.IsZero() || snapshot.StartTime.Before(oldest) {
+				oldest = snapshot.StartTime
+			}
+		}
+
+		if oldest.IsZero() {
+			return time.Time{}, fmt.Errorf("no snapshots")
+		}
+
+		return oldest, nil
+	default:
+		return ami.CreationDate, nil
+	}
+}
+
+func (s AgeSource) parse(value string) (time.Time, error) {
+	layout := s.Layout
+	if layout == "" {
+		layout = DefaultNameDateLayout
+	}
+
+	return time.Parse(layout, value)
+}
@@ -0,0 +1,67 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgeSourceTime(t *testing.T) {
+	created := time.Date(2026, 10, 10, 12, 0, 0, 0, time.UTC)
+	ami := AMI{
+		Name:         "northflier-2026-09-01-abc",
+		CreationDate: created,
+		Tags:         map[string]string{"BuildDate": "2026-08-15T10:00:00Z", "Day": "2026-08-16"},
+		Snapshots: []Snapshot{
+			{ID: "snap-2", StartTime: time.Date(2026, 9, 2, 0, 0, 0, 0, time.UTC)},
+			{ID: "snap-1", StartTime: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		kind     string
+		layout   string
+		regex    string
+		tag      string
+		expected time.Time
+		wantErr  bool
+	}{
+		{name: "default", expected: created},
+		{name: "creation", kind: AgeSourceCreation, expected: created},
+		{name: "name", kind: AgeSourceName, regex: DefaultNameDateRegex, expected: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "name custom layout", kind: AgeSourceName, layout: "2006-01", regex: `(\d{4}-\d{2})-\d{2}`, expected: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "tag rfc3339", kind: AgeSourceTag, tag: "BuildDate", expected: time.Date(2026, 8, 15, 10, 0, 0, 0, time.UTC)},
+		{name: "tag layout", kind: AgeSourceTag, tag: "Day", expected: time.Date(2026, 8, 16, 0, 0, 0, 0, time.UTC)},
+		{name: "name without date", kind: AgeSourceName, regex: `\d{8}`, wantErr: true},
+		{name: "tag missing", kind: AgeSourceTag, tag: "Nope", wantErr: true},
+		{name: "snapshot", kind: AgeSourceSnapshot, expected: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewAgeSource(tt.kind, tt.layout, tt.regex, tt.tag)
+			if err != nil {
+				t.Fatalf("NewAgeSource() error = %v", err)
+			}
+
+			got, err := source.Time(ami)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Time() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !got.Equal(tt.expected) {
+				t.Errorf("Time() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewAgeSourceRejectsInvalid(t *testing.T) {
+	if _, err := NewAgeSource("mtime", "", "", ""); err == nil {
+		t.Error("NewAgeSource() error = nil, want invalid kind error")
+	}
+
+	if _, err := NewAgeSource(AgeSourceTag, "", "", ""); err == nil {
+		t.Error("NewAgeSource() error = nil, want missing tag error")
+	}
+}
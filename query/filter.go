@@ -0,0 +1,157 @@
+package query
+
+import (
+	"log/slog"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/gkwa/fragiledonkey/pattern"
+)
+
+// Filter selects the AMIs a query returns. Patterns and States are sent to EC2
+// as server-side filters, Exclude and NameRegex are applied to the results.
+type Filter struct {
+	Patterns  []string
+	Exclude   []string
+	States    []string
+	NameRegex *regexp.Regexp
+}
+
+// RegexPattern returns a server-side name pattern that covers every name re
+// can match, built from its literal prefix, so a regex can be used without
+// also spelling out a wildcard pattern. A regex without a literal prefix
+// yields "*", which lists every image and leaves the matching to NameRegex;
+// pattern.Lint rejects that for commands that change images.
+func RegexPattern(re *regexp.Regexp) string {
+	prefix, anchored := literalPrefix(re.String())
+	if prefix == "" {
+		slog.Warn("name regex has no literal prefix, listing every image and matching names client-side", "regex", re.String())
+		return "*"
+	}
+
+	if anchored {
+		return prefix + "*"
+	}
+
+	return "*" + prefix + "*"
+}
+
+// literalPrefix returns the literal text every match of expr starts with and
+// whether expr is anchored to the start of the name. Unlike
+// regexp.Regexp.LiteralPrefix it also finds the prefix of anchored
+// expressions that are not one-pass, such as "^a-(?:[^r]|r[^c])".
+func literalPrefix(expr string) (string, bool) {
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+
+	subs := []*syntax.Regexp{parsed.Simplify()}
+	if subs[0].Op == syntax.OpConcat {
+		subs = subs[0].Sub
+	}
+
+	anchored := false
+	if len(subs) > 0 && subs[0].Op == syntax.OpBeginText {
+		anchored = true
+		subs = subs[1:]
+	}
+
+	var prefix strings.Builder
+
+	for _, sub := range subs {
+		// EC2 name filters are case sensitive, so a case-folded literal
+		// cannot be sent as is.
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix.WriteString(string(sub.Rune))
+	}
+
+	return prefix.String(), anchored
+}
+
+// String describes the filter for logs and metric labels.
+func (f Filter) String() string {
+	parts := append([]string{}, f.Patterns...)
+	for _, e := range f.Exclude {
+		parts = append(parts, "!"+e)
+	}
+	if f.NameRegex != nil {
+		parts = append(parts, "~"+f.NameRegex.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f Filter) ec2Filters() []types.Filter {
+	filters := []types.Filter{
+		{
+			Name:   aws.String("name"),
+			Values: f.Patterns,
+		},
+	}
+
+	states := f.States
+	for _, s := range states {
+		if s == "all" {
+			return filters
+		}
+	}
+
+	if len(states) == 0 {
+		states = []string{string(types.ImageStateAvailable)}
+	}
+
+	return append(filters, types.Filter{
+		Name:   aws.String("state"),
+		Values: states,
+	})
+}
+
+// Matches applies the whole filter client-side, the way EC2 and
+// describeImages would together, for AMIs that were not just described.
+func (f Filter) Matches(ami AMI) bool {
+	if len(f.Patterns) > 0 && !pattern.MatchAny(f.Patterns, ami.Name) {
+		return false
+	}
+
+	if f.excluded(ami.Name) {
+		return false
+	}
+
+	states := f.States
+	if len(states) == 0 {
+		states = []string{string(types.ImageStateAvailable)}
+	}
+
+	for _, s := range states {
+		if s == "all" || s == ami.State {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f Filter) excluded(name string) bool {
+	if f.NameRegex != nil && !f.NameRegex.MatchString(name) {
+		return true
+	}
+	return pattern.MatchAny(f.Exclude, name)
+}
+
+// WarnMixedPrefixes logs patterns that matched images from more than one name
+// family, which usually means the pattern is broader than intended.
+func (f Filter) WarnMixedPrefixes(amis []AMI) {
+	names := make([]string, 0, len(amis))
+	for _, ami := range amis {
+		names = append(names, ami.Name)
+	}
+
+	for p, prefixes := range pattern.MixedPrefixes(f.Patterns, names) {
+		slog.Warn("pattern matches images with different prefixes", "pattern", p, "prefixes", strings.Join(prefixes, ","))
+	}
+}
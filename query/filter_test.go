@@ -0,0 +1,84 @@
+package query
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRegexPattern(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{expr: `^northflier-\d{4}-\d{2}-\d{2}-`, expected: "northflier-*"},
+		{expr: `^northflier-\d{4}-\d{2}-\d{2}-(?:[^r]|r[^c])`, expected: "northflier-*"},
+		{expr: `northflier-\d{4}`, expected: "*northflier-*"},
+		{expr: `^(?i)northflier-`, expected: "*"},
+		{expr: `^(northflier|nginx)-`, expected: "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got := RegexPattern(regexp.MustCompile(tt.expr))
+			if got != tt.expected {
+				t.Errorf("RegexPattern() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterExcluded(t *testing.T) {
+	filter := Filter{
+		Exclude:   []string{"*-rc*"},
+		NameRegex: regexp.MustCompile(`^northflier-\d{4}-(0[1-9]|1[0-2])-(0[1-9]|[12]\d|3[01])-`),
+	}
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{name: "northflier-2026-10-01-abc", expected: false},
+		{name: "northflier-2026-13-01-abc", expected: true},
+		{name: "northflier-2026-10-01-rc1", expected: true},
+		{name: "nginx-2026-10-01-abc", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.excluded(tt.name); got != tt.expected {
+				t.Errorf("excluded(%q) = %v, want %v", tt.name, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	f := Filter{
+		Patterns:  []string{"northflier-????-??-??-*"},
+		Exclude:   []string{"*-rc*"},
+		States:    []string{"available", "failed"},
+		NameRegex: regexp.MustCompile(`^northflier-\d{4}-(0[1-9]|1[0-2])-`),
+	}
+
+	tests := []struct {
+		ami      AMI
+		expected bool
+	}{
+		{ami: AMI{Name: "northflier-2026-10-01-a", State: "available"}, expected: true},
+		{ami: AMI{Name: "northflier-2026-10-01-a", State: "failed"}, expected: true},
+		{ami: AMI{Name: "northflier-2026-10-01-a", State: "pending"}, expected: false},
+		{ami: AMI{Name: "northflier-2026-10-01-rc1", State: "available"}, expected: false},
+		{ami: AMI{Name: "northflier-2026-13-01-a", State: "available"}, expected: false},
+		{ami: AMI{Name: "nginx-2026-10-01-a", State: "available"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		if got := f.Matches(tt.ami); got != tt.expected {
+			t.Errorf("Matches(%s %s) = %v, want %v", tt.ami.Name, tt.ami.State, got, tt.expected)
+		}
+	}
+
+	if (Filter{}).Matches(AMI{Name: "anything", State: "pending"}) {
+		t.Error("zero Filter matched a pending AMI, want available only")
+	}
+}
@@ -0,0 +1,60 @@
+package query
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/gkwa/fragiledonkey/ec2client"
+)
+
+// maxFilterValues is the most values EC2 accepts in a single filter.
+const maxFilterValues = 200
+
+// ImagesInUse returns, keyed by AMI ID, the instances launched from any of
+// imageIDs that have not been terminated.
+func ImagesInUse(ctx context.Context, client *ec2.Client, region string, imageIDs []string) (map[string][]string, error) {
+	inUse := make(map[string][]string)
+
+	for start := 0; start < len(imageIDs); start += maxFilterValues {
+		end := min(start+maxFilterValues, len(imageIDs))
+
+		input := &ec2.DescribeInstancesInput{
+			Filters: []types.Filter{
+				{
+					Name:   aws.String("image-id"),
+					Values: imageIDs[start:end],
+				},
+				{
+					Name:   aws.String("instance-state-name"),
+					Values: []string{"pending", "running", "shutting-down", "stopping", "stopped"},
+				},
+			},
+		}
+
+		paginator := ec2.NewDescribeInstancesPaginator(client, input)
+		for paginator.HasMorePages() {
+			callStart := time.Now()
+			callCtx, cancel := ec2client.CallContext(ctx)
+			page, err := paginator.NextPage(callCtx)
+			cancel()
+			if err != nil {
+				return nil, err
+			}
+
+			slog.Debug("described instances", "region", region, "action", "DescribeInstances", "duration_ms", time.Since(callStart).Milliseconds())
+
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					id := aws.ToString(instance.ImageId)
+					inUse[id] = append(inUse[id], aws.ToString(instance.InstanceId))
+				}
+			}
+		}
+	}
+
+	return inUse, nil
+}
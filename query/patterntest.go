@@ -0,0 +1,113 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"github.com/gkwa/fragiledonkey/pattern"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+type patternMatch struct {
+	id    string
+	name  string
+	state string
+}
+
+// RunPatternTest prints, per region, the images filter matches. Only image
+// names are fetched so it is cheap to run while tuning a pattern.
+func RunPatternTest(ctx context.Context, filter Filter) error {
+	if err := pattern.Lint(filter.Patterns); err != nil {
+		slog.Warn("pattern would be rejected by cleanup", "error", err)
+	}
+
+	regions, err := ec2client.Regions(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting regions: %w", err)
+	}
+
+	sem := semaphore.NewWeighted(maxConcurrentRequests)
+	var g errgroup.Group
+	var mu sync.Mutex
+	matches := make(map[string][]patternMatch)
+
+	for _, region := range regions {
+		region := region
+		if err := sem.Acquire(ctx, 1); err != nil {
+			continue
+		}
+
+		g.Go(func() error {
+			defer sem.Release(1)
+
+			client, err := ec2client.New(ctx, region)
+			if err != nil {
+				slog.Error("error loading config", "region", region, "error", err)
+				return err
+			}
+
+			images, err := describeImages(ctx, client, filter, region)
+			if err != nil {
+				if !isIgnoredError(err) && ctx.Err() == nil {
+					slog.Error("error describing images", "region", region, "action", "DescribeImages", "error", err)
+				}
+				return nil
+			}
+
+			var found []patternMatch
+			for _, image := range images {
+				found = append(found, patternMatch{
+					id:    aws.ToString(image.ImageId),
+					name:  aws.ToString(image.Name),
+					state: string(image.State),
+				})
+			}
+
+			sort.Slice(found, func(i, j int) bool { return found[i].name < found[j].name })
+
+			mu.Lock()
+			if len(found) > 0 {
+				matches[region] = found
+			}
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return fmt.Errorf("error testing pattern: %w", err)
+	}
+
+	matched := make([]string, 0, len(matches))
+	for region := range matches {
+		matched = append(matched, region)
+	}
+	sort.Strings(matched)
+
+	var names []string
+
+	for _, region := range matched {
+		fmt.Printf("%s (%d)\n", region, len(matches[region]))
+
+		for _, m := range matches[region] {
+			fmt.Printf("    %-22s %-45s %s\n", m.id, m.name, m.state)
+			names = append(names, m.name)
+		}
+	}
+
+	fmt.Printf("Prefixes: %s\n", strings.Join(pattern.Prefixes(names), ", "))
+
+	for p, prefixes := range pattern.MixedPrefixes(filter.Patterns, names) {
+		slog.Warn("pattern matches images with different prefixes", "pattern", p, "prefixes", strings.Join(prefixes, ","))
+	}
+
+	return ctx.Err()
+}
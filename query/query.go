@@ -3,39 +3,102 @@ package query
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
-	"github.com/dustin/go-humanize/english"
+	"github.com/gkwa/fragiledonkey/clock"
 	"github.com/gkwa/fragiledonkey/duration"
-	"github.com/taylormonacelli/lemondrop"
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"github.com/gkwa/fragiledonkey/metrics"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 )
 
 type AMI struct {
-	ID           string    `json:"id"`
-	Name         string    `json:"name"`
-	CreationDate time.Time `json:"creation_date"`
-	Snapshots    []string  `json:"snapshots"`
-	State        string    `json:"state"`
-	Region       string    `json:"region"`
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	CreationDate time.Time         `json:"creation_date"`
+	Snapshots    []Snapshot        `json:"snapshots"`
+	State        string            `json:"state"`
+	Region       string            `json:"region"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Public       bool              `json:"public,omitempty"`
+	// LaunchPermission is only known after FetchSharing.
+	LaunchPermission Sharing `json:"launch_permission,omitzero"`
 }
 
-type SnapshotInfo struct {
-	ID          string
-	Age         string
-	Description string
+type Snapshot struct {
+	ID          string    `json:"id"`
+	State       string    `json:"state"`
+	Progress    string    `json:"progress"`
+	StartTime   time.Time `json:"start_time"`
+	Description string    `json:"description"`
+	VolumeSize  int32     `json:"volume_size"`
+	// CreateVolumePermission is only known after FetchSharing.
+	CreateVolumePermission Sharing `json:"create_volume_permission,omitzero"`
+}
+
+// IsStuck reports whether the snapshot has been pending for longer than
+// threshold.
+func (s Snapshot) IsStuck(now time.Time, threshold time.Duration) bool {
+	return s.State == string(types.SnapshotStatePending) && now.Sub(s.StartTime) > threshold
 }
 
 const maxConcurrentRequests = 10
 
+// ImageStates lists the AMI states accepted by --state. "all" disables the
+// server-side state filter entirely.
+var ImageStates = []string{
+	string(types.ImageStatePending),
+	string(types.ImageStateAvailable),
+	string(types.ImageStateInvalid),
+	string(types.ImageStateFailed),
+	string(types.ImageStateError),
+	string(types.ImageStateDisabled),
+	"all",
+}
+
+// BrokenImageStates are states an image never recovers from, typically left
+// behind by a failed Packer build.
+var BrokenImageStates = []string{
+	string(types.ImageStateFailed),
+	string(types.ImageStateError),
+	string(types.ImageStateInvalid),
+}
+
+func IsBrokenState(state string) bool {
+	for _, s := range BrokenImageStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateStates(states []string) error {
+	for _, state := range states {
+		valid := false
+		for _, s := range ImageStates {
+			if s == state {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid image state %q, must be one of %s", state, strings.Join(ImageStates, ", "))
+		}
+	}
+	return nil
+}
+
 var ignoreStatusCodes = []int{
 	401, // don't show me errors when I don't have access to region
 }
@@ -49,35 +112,72 @@ func isIgnoredError(err error) bool {
 	return false
 }
 
-func QueryAMIs(client *ec2.Client, pattern, region string) []AMI {
+// describeImages returns the images in region matching filter, with Exclude
+// already applied.
+func describeImages(ctx context.Context, client *ec2.Client, filter Filter, region string) ([]types.Image, error) {
 	input := &ec2.DescribeImagesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("name"),
-				Values: []string{pattern},
-			},
-			{
-				Name:   aws.String("state"),
-				Values: []string{"available"},
-			},
-		},
-		Owners: []string{"self"},
+		Filters: filter.ec2Filters(),
+		Owners:  []string{"self"},
 	}
 
-	result, err := client.DescribeImages(context.Background(), input)
+	start := time.Now()
+	callCtx, cancel := ec2client.CallContext(ctx)
+	result, err := client.DescribeImages(callCtx, input)
+	cancel()
 	if err != nil {
-		if !isIgnoredError(err) {
-			fmt.Printf("Error describing images in region %s: %v\n", region, err)
+		return nil, err
+	}
+
+	slog.Debug("described images", "region", region, "action", "DescribeImages", "count", len(result.Images), "duration_ms", time.Since(start).Milliseconds())
+
+	var images []types.Image
+
+	for _, image := range result.Images {
+		if filter.excluded(aws.ToString(image.Name)) {
+			slog.Debug("excluded image", "region", region, "ami_id", aws.ToString(image.ImageId), "name", aws.ToString(image.Name))
+			continue
 		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// QueryAMIs returns the images in region matching filter with their
+// snapshots, newest first. A region that cannot be described is logged and
+// yields nil.
+func QueryAMIs(ctx context.Context, client *ec2.Client, filter Filter, region string) []AMI {
+	amis, err := queryRegion(ctx, client, filter, region)
+	if err != nil {
+		logRegionError(ctx, region, err)
 		return nil
 	}
+	return amis
+}
+
+func logRegionError(ctx context.Context, region string, err error) {
+	if !isIgnoredError(err) && ctx.Err() == nil {
+		slog.Error("error describing images", "region", region, "action", "DescribeImages", "error", err)
+	}
+}
+
+// queryRegion is QueryAMIs returning the error describing the images.
+func queryRegion(ctx context.Context, client *ec2.Client, filter Filter, region string) ([]AMI, error) {
+	images, err := describeImages(ctx, client, filter, region)
+	if err != nil {
+		return nil, err
+	}
 
 	var amis []AMI
 
-	for _, image := range result.Images {
+	for _, image := range images {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		creationTime, err := time.Parse(time.RFC3339, *image.CreationDate)
 		if err != nil {
-			fmt.Println("Error parsing creation date:", err)
+			slog.Error("error parsing creation date", "region", region, "ami_id", aws.ToString(image.ImageId), "error", err)
 			continue
 		}
 
@@ -87,6 +187,14 @@ func QueryAMIs(client *ec2.Client, pattern, region string) []AMI {
 			CreationDate: creationTime,
 			State:        string(image.State),
 			Region:       region,
+			Public:       aws.ToBool(image.Public),
+		}
+
+		for _, tag := range image.Tags {
+			if ami.Tags == nil {
+				ami.Tags = make(map[string]string)
+			}
+			ami.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
 		}
 
 		input := &ec2.DescribeSnapshotsInput{
@@ -95,22 +203,30 @@ func QueryAMIs(client *ec2.Client, pattern, region string) []AMI {
 					Name:   aws.String("description"),
 					Values: []string{fmt.Sprintf("*%s*", *image.ImageId)},
 				},
-				{
-					Name:   aws.String("status"),
-					Values: []string{"completed"},
-				},
 			},
 			OwnerIds: []string{"self"},
 		}
 
-		snapshotResult, err := client.DescribeSnapshots(context.Background(), input)
+		start := time.Now()
+		callCtx, cancel := ec2client.CallContext(ctx)
+		snapshotResult, err := client.DescribeSnapshots(callCtx, input)
+		cancel()
 		if err != nil {
-			fmt.Println("Error describing snapshots:", err)
+			slog.Error("error describing snapshots", "region", region, "ami_id", ami.ID, "action", "DescribeSnapshots", "error", err)
 			continue
 		}
 
+		slog.Debug("described snapshots", "region", region, "ami_id", ami.ID, "action", "DescribeSnapshots", "count", len(snapshotResult.Snapshots), "duration_ms", time.Since(start).Milliseconds())
+
 		for _, snapshot := range snapshotResult.Snapshots {
-			ami.Snapshots = append(ami.Snapshots, *snapshot.SnapshotId)
+			ami.Snapshots = append(ami.Snapshots, Snapshot{
+				ID:          aws.ToString(snapshot.SnapshotId),
+				State:       string(snapshot.State),
+				Progress:    aws.ToString(snapshot.Progress),
+				StartTime:   aws.ToTime(snapshot.StartTime),
+				Description: aws.ToString(snapshot.Description),
+				VolumeSize:  aws.ToInt32(snapshot.VolumeSize),
+			})
 		}
 
 		amis = append(amis, ami)
@@ -120,24 +236,82 @@ func QueryAMIs(client *ec2.Client, pattern, region string) []AMI {
 		return amis[i].CreationDate.After(amis[j].CreationDate)
 	})
 
-	return amis
+	return amis, nil
 }
 
-func QueryAMIsAllRegions(pattern string) ([]AMI, error) {
-	regionDetails, err := lemondrop.GetRegionDetails()
+// QueryAMIsAllRegions returns the matching images of every region. Regions
+// whose images cannot be described are logged and left out.
+func QueryAMIsAllRegions(ctx context.Context, filter Filter) ([]AMI, error) {
+	listing, err := QueryAMIsEachRegion(ctx, filter)
 	if err != nil {
-		fmt.Println("Error getting region details:", err)
 		return nil, err
 	}
 
-	ctx := context.Background()
+	listing.logFailed(ctx)
+
+	return listing.AMIs, nil
+}
+
+// Listing is the outcome of querying every region, keeping the regions whose
+// images could not be described apart so callers do not mistake them for
+// regions without matches.
+type Listing struct {
+	AMIs []AMI
+	// Regions are all regions queried, failed or not, sorted.
+	Regions []string
+	// Disabled are the regions that rejected the credentials, as EC2 does
+	// in opt-in regions the account has not opted in to, sorted. They count
+	// as holding no AMIs rather than as failed.
+	Disabled []string
+	// Failed holds the error of every region whose images could not be
+	// described, keyed by region.
+	Failed map[string]error
+}
+
+// EnabledRegions returns the queried regions that accepted the credentials,
+// sorted.
+func (l Listing) EnabledRegions() []string {
+	return slices.DeleteFunc(slices.Clone(l.Regions), func(region string) bool {
+		return slices.Contains(l.Disabled, region)
+	})
+}
+
+// FailedRegions returns the regions in l.Failed, sorted.
+func (l Listing) FailedRegions() []string {
+	regions := make([]string, 0, len(l.Failed))
+	for region := range l.Failed {
+		regions = append(regions, region)
+	}
+
+	sort.Strings(regions)
+
+	return regions
+}
+
+func (l Listing) logFailed(ctx context.Context) {
+	for _, region := range l.FailedRegions() {
+		logRegionError(ctx, region, l.Failed[region])
+	}
+}
+
+// QueryAMIsEachRegion is QueryAMIsAllRegions returning which regions were
+// queried and which of them failed.
+func QueryAMIsEachRegion(ctx context.Context, filter Filter) (Listing, error) {
+	regions, err := ec2client.Regions(ctx)
+	if err != nil {
+		slog.Error("error getting regions", "error", err)
+		return Listing{}, err
+	}
+
 	sem := semaphore.NewWeighted(maxConcurrentRequests)
 	var g errgroup.Group
 	var mu sync.Mutex
 	var allAMIs []AMI
+	var disabled []string
+	regionErrs := make(map[string]error)
 
-	for _, rd := range regionDetails {
-		rd := rd
+	for _, region := range regions {
+		region := region
 		err := sem.Acquire(ctx, 1)
 		if err != nil {
 			continue
@@ -146,16 +320,21 @@ func QueryAMIsAllRegions(pattern string) ([]AMI, error) {
 		g.Go(func() error {
 			defer sem.Release(1)
 
-			cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(rd.Region))
+			client, err := ec2client.New(ctx, region)
 			if err != nil {
-				fmt.Printf("Error loading config for region %s: %v\n", rd.Region, err)
+				slog.Error("error loading config", "region", region, "error", err)
 				return err
 			}
 
-			client := ec2.NewFromConfig(cfg)
-			amis := QueryAMIs(client, pattern, rd.Region)
+			amis, err := queryRegion(ctx, client, filter, region)
 
 			mu.Lock()
+			switch {
+			case err != nil && isIgnoredError(err):
+				disabled = append(disabled, region)
+			case err != nil:
+				regionErrs[region] = err
+			}
 			allAMIs = append(allAMIs, amis...)
 			mu.Unlock()
 
@@ -164,124 +343,156 @@ func QueryAMIsAllRegions(pattern string) ([]AMI, error) {
 	}
 
 	if err := g.Wait(); err != nil {
-		return nil, err
+		return Listing{}, err
 	}
 
-	fmt.Printf("Found %d %s from %d %s queried\n",
-		len(allAMIs),
-		english.PluralWord(len(allAMIs), "AMI", ""),
-		len(regionDetails),
-		english.PluralWord(len(regionDetails), "region", ""))
+	if err := ctx.Err(); err != nil {
+		return Listing{}, err
+	}
 
-	return allAMIs, nil
-}
+	recordInventory(filter.String(), regions, allAMIs, regionErrs)
 
-func querySnapshotsForAMI(ami AMI, now time.Time) ([]SnapshotInfo, error) {
-	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(ami.Region))
-	if err != nil {
-		return nil, fmt.Errorf("error loading config for region %s: %v", ami.Region, err)
-	}
+	slog.Info("queried AMIs", "amis", len(allAMIs), "regions", len(regions))
 
-	ctx := context.Background()
-	sem := semaphore.NewWeighted(maxConcurrentRequests)
-	var g errgroup.Group
-	var snapshots []SnapshotInfo
-	var mu sync.Mutex
+	sorted := append([]string(nil), regions...)
+	sort.Strings(sorted)
+	sort.Strings(disabled)
 
-	for _, snapshotID := range ami.Snapshots {
-		snapshotID := snapshotID
-		err := sem.Acquire(ctx, 1)
-		if err != nil {
+	return Listing{AMIs: allAMIs, Regions: sorted, Disabled: disabled, Failed: regionErrs}, nil
+}
+
+// recordInventory publishes AMI and snapshot gauges for every queried region,
+// including regions without matches so stale values do not linger. Regions
+// that failed keep their last values and are flagged by the query failure
+// gauge instead, so a failure never reads as "no AMIs".
+func recordInventory(pattern string, regions []string, amis []AMI, failed map[string]error) {
+	for _, region := range regions {
+		if _, ok := failed[region]; ok {
+			metrics.QueryFailed.WithLabelValues(region).Set(1)
 			continue
 		}
 
-		g.Go(func() error {
-			defer sem.Release(1)
-
-			input := &ec2.DescribeSnapshotsInput{
-				SnapshotIds: []string{snapshotID},
-			}
-
-			snapshotResult, err := ec2.NewFromConfig(cfg).DescribeSnapshots(ctx, input)
-			if err != nil {
-				return fmt.Errorf("error describing snapshot %s: %v", snapshotID, err)
-			}
+		metrics.QueryFailed.WithLabelValues(region).Set(0)
 
-			if len(snapshotResult.Snapshots) > 0 {
-				snapshot := snapshotResult.Snapshots[0]
-				startTime := *snapshot.StartTime
-				age := duration.RelativeAge(now.Sub(startTime))
-
-				mu.Lock()
-				snapshots = append(snapshots, SnapshotInfo{
-					ID:          snapshotID,
-					Age:         age,
-					Description: *snapshot.Description,
-				})
-				mu.Unlock()
-			}
-			return nil
-		})
+		for _, vec := range []*prometheus.GaugeVec{metrics.AMIs, metrics.Snapshots, metrics.SnapshotGiB} {
+			vec.DeletePartialMatch(prometheus.Labels{"region": region})
+			vec.WithLabelValues(region, pattern).Set(0)
+		}
 	}
 
-	if err := g.Wait(); err != nil {
-		return nil, err
+	for _, ami := range amis {
+		metrics.AMIs.WithLabelValues(ami.Region, pattern).Inc()
+
+		for _, snapshot := range ami.Snapshots {
+			metrics.Snapshots.WithLabelValues(ami.Region, pattern).Inc()
+			metrics.SnapshotGiB.WithLabelValues(ami.Region, pattern).Add(float64(snapshot.VolumeSize))
+		}
 	}
+}
 
-	return snapshots, nil
+// Display controls how RunQueryAllRegions renders the inventory.
+type Display struct {
+	// Age is the timestamp the AMI age column is measured from.
+	Age    AgeSource
+	Format duration.Format
+	// StuckAfter flags snapshots pending for longer than this.
+	StuckAfter time.Duration
+	// Sharing fetches and shows who each AMI and snapshot is shared with.
+	Sharing bool
+	// Clock supplies the time ages are measured against, the system clock
+	// when nil.
+	Clock clock.Clock
 }
 
-func RunQueryAllRegions(pattern string) {
-	amis, err := QueryAMIsAllRegions(pattern)
+// RunQueryAllRegions prints the matching AMIs with their snapshots and
+// returns the listing they came from.
+func RunQueryAllRegions(ctx context.Context, filter Filter, display Display) (Listing, error) {
+	if err := ValidateStates(filter.States); err != nil {
+		return Listing{}, err
+	}
+
+	listing, err := QueryAMIsEachRegion(ctx, filter)
 	if err != nil {
-		fmt.Println("Error querying AMIs across regions:", err)
-		return
+		return Listing{}, fmt.Errorf("error querying AMIs across regions: %w", err)
 	}
 
-	now := time.Now()
+	listing.logFailed(ctx)
 
-	ctx := context.Background()
-	sem := semaphore.NewWeighted(maxConcurrentRequests)
-	var g errgroup.Group
+	amis := listing.AMIs
 
-	type amiWithSnapshots struct {
-		ami       AMI
-		snapshots []SnapshotInfo
+	filter.WarnMixedPrefixes(amis)
+
+	if display.Sharing {
+		FetchSharingAllRegions(ctx, amis)
 	}
 
-	results := make([]amiWithSnapshots, len(amis))
+	now := clock.Now(display.Clock)
+	width := display.Format.Width()
 
-	for i, ami := range amis {
-		i, ami := i, ami
-		err := sem.Acquire(ctx, 1)
-		if err != nil {
-			continue
+	var stuck []Snapshot
+
+	shared, unknown := 0, 0
+
+	for _, ami := range amis {
+		age := "?"
+		if t, err := display.Age.Time(ami); err != nil {
+			slog.Warn("cannot determine age", "region", ami.Region, "ami_id", ami.ID, "age_source", display.Age.Kind, "error", err)
+		} else {
+			age = display.Format.Age(t, now)
 		}
+		fmt.Printf("%-*s %-20s %-20s %-15s %s%s\n", width, age, ami.ID, ami.Name, ami.Region, ami.State, sharedMarker(ami.LaunchPermission))
 
-		g.Go(func() error {
-			defer sem.Release(1)
+		if ami.Shared() {
+			shared++
+			slog.Warn("image is shared", "region", ami.Region, "ami_id", ami.ID, "launch_permission", ami.LaunchPermission.String())
+		}
 
-			snapshots, err := querySnapshotsForAMI(ami, now)
-			if err != nil {
-				return err
+		if ami.SharingUnknown() {
+			unknown++
+		}
+
+		for _, snapshot := range ami.Snapshots {
+			age := display.Format.Age(snapshot.StartTime, now)
+
+			if snapshot.State == string(types.SnapshotStateCompleted) {
+				fmt.Printf("    %-*s %-20s %s%s\n", width, age, snapshot.ID, snapshot.Description, sharedMarker(snapshot.CreateVolumePermission))
+				continue
 			}
 
-			results[i] = amiWithSnapshots{ami: ami, snapshots: snapshots}
-			return nil
-		})
+			marker := ""
+			if snapshot.IsStuck(now, display.StuckAfter) {
+				marker = " STUCK"
+				stuck = append(stuck, snapshot)
+				slog.Warn("snapshot stuck in pending", "region", ami.Region, "ami_id", ami.ID, "snapshot_id", snapshot.ID, "progress", snapshot.Progress, "age", age)
+			}
+
+			fmt.Printf("    %-*s %-20s %s [%s %s%s]\n", width, age, snapshot.ID, snapshot.Description, snapshot.State, snapshot.Progress, marker)
+		}
 	}
 
-	if err := g.Wait(); err != nil {
-		fmt.Println("Error querying snapshots:", err)
-		return
+	if len(stuck) > 0 {
+		slog.Warn("snapshots stuck in pending", "count", len(stuck), "stuck_after", display.StuckAfter)
 	}
 
-	for _, result := range results {
-		age := duration.RelativeAge(now.Sub(result.ami.CreationDate))
-		fmt.Printf("%-5s %-20s %-20s %s\n", age, result.ami.ID, result.ami.Name, result.ami.Region)
+	if shared > 0 {
+		slog.Warn("AMIs shared publicly or with other accounts", "count", shared)
+	}
 
-		for _, snapshot := range result.snapshots {
-			fmt.Printf("    %-5s %-20s %s\n", snapshot.Age, snapshot.ID, snapshot.Description)
-		}
+	if unknown > 0 {
+		slog.Warn("AMIs whose sharing could not be checked", "count", unknown)
+	}
+
+	return listing, nil
+}
+
+// sharedMarker flags shared resources, and those whose sharing could not be
+// described, in the printed inventory.
+func sharedMarker(s Sharing) string {
+	switch {
+	case s.Shared():
+		return " SHARED(" + s.String() + ")"
+	case s.Unknown:
+		return " SHARING UNKNOWN"
 	}
+	return ""
 }
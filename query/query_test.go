@@ -0,0 +1,89 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"github.com/gkwa/fragiledonkey/ec2stub"
+	"github.com/gkwa/fragiledonkey/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordInventory(t *testing.T) {
+	amis := []AMI{
+		{ID: "ami-1", Region: "us-west-2", Snapshots: []Snapshot{{ID: "snap-1", VolumeSize: 8}, {ID: "snap-2", VolumeSize: 20}}},
+		{ID: "ami-2", Region: "us-west-2", Snapshots: []Snapshot{{ID: "snap-3", VolumeSize: 8}}},
+	}
+
+	// A region that fails keeps what the last successful query found.
+	metrics.AMIs.WithLabelValues("ap-south-1", "northflier-*").Set(4)
+
+	recordInventory("northflier-*", []string{"us-west-2", "eu-central-1", "ap-south-1"}, amis, map[string]error{"ap-south-1": errors.New("throttled")})
+
+	tests := []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{name: "amis", got: testutil.ToFloat64(metrics.AMIs.WithLabelValues("us-west-2", "northflier-*")), expected: 2},
+		{name: "snapshots", got: testutil.ToFloat64(metrics.Snapshots.WithLabelValues("us-west-2", "northflier-*")), expected: 3},
+		{name: "gib", got: testutil.ToFloat64(metrics.SnapshotGiB.WithLabelValues("us-west-2", "northflier-*")), expected: 36},
+		{name: "empty region", got: testutil.ToFloat64(metrics.AMIs.WithLabelValues("eu-central-1", "northflier-*")), expected: 0},
+		{name: "failed region", got: testutil.ToFloat64(metrics.AMIs.WithLabelValues("ap-south-1", "northflier-*")), expected: 4},
+		{name: "failed region flagged", got: testutil.ToFloat64(metrics.QueryFailed.WithLabelValues("ap-south-1")), expected: 1},
+		{name: "queried region not flagged", got: testutil.ToFloat64(metrics.QueryFailed.WithLabelValues("us-west-2")), expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestQueryAMIsAgainstStub(t *testing.T) {
+	ec2stub.Start(t, `
+images:
+  - {id: ami-1, name: northflier-2026-08-01-a, region: us-west-2, creation_date: 2026-08-01T00:00:00Z, tags: {BuildDate: "2026-07-30"}}
+  - {id: ami-2, name: northflier-2026-08-02-a, region: us-west-2, state: failed, creation_date: 2026-08-02T00:00:00Z}
+  - {id: ami-3, name: northflier-2026-08-03-rc1, region: us-west-2, creation_date: 2026-08-03T00:00:00Z}
+  - {id: ami-4, name: nginx-2026-08-01-a, region: us-west-2, creation_date: 2026-08-01T00:00:00Z}
+snapshots:
+  - {id: snap-1, region: us-west-2, description: Created by CreateImage(i-0) for ami-1, volume_size: 8}
+  - {id: snap-2, region: us-west-2, description: Created by CreateImage(i-0) for ami-1, state: pending, progress: 40%, volume_size: 20}
+instances:
+  - {id: i-1, region: us-west-2, image_id: ami-1}
+  - {id: i-2, region: us-west-2, image_id: ami-2, state: terminated}
+`)
+
+	ctx := context.Background()
+
+	client, err := ec2client.New(ctx, "us-west-2")
+	if err != nil {
+		t.Fatalf("ec2client.New() error = %v", err)
+	}
+
+	filter := Filter{Patterns: []string{"northflier-*"}, Exclude: []string{"*-rc*"}, States: []string{"available", "failed"}}
+
+	amis := QueryAMIs(ctx, client, filter, "us-west-2")
+	if len(amis) != 2 || amis[0].ID != "ami-2" || amis[1].ID != "ami-1" {
+		t.Fatalf("QueryAMIs() = %v, want ami-2 and ami-1 newest first", amis)
+	}
+
+	if amis[1].Tags["BuildDate"] != "2026-07-30" || len(amis[1].Snapshots) != 2 {
+		t.Errorf("ami-1 tags = %v snapshots = %v", amis[1].Tags, amis[1].Snapshots)
+	}
+
+	inUse, err := ImagesInUse(ctx, client, "us-west-2", []string{"ami-1", "ami-2"})
+	if err != nil {
+		t.Fatalf("ImagesInUse() error = %v", err)
+	}
+
+	if len(inUse) != 1 || len(inUse["ami-1"]) != 1 || inUse["ami-1"][0] != "i-1" {
+		t.Errorf("ImagesInUse() = %v, want ami-1 used by i-1", inUse)
+	}
+}
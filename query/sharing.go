@@ -0,0 +1,294 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// Sharing is who besides the owner may launch an image or create volumes
+// from a snapshot.
+type Sharing struct {
+	Public   bool     `json:"public,omitempty"`
+	Accounts []string `json:"accounts,omitempty"`
+	// Organizations holds organization and organizational unit ARNs; only
+	// images can be shared with them.
+	Organizations []string `json:"organizations,omitempty"`
+	// Unknown is set when the permissions could not be described, so the
+	// resource may be shared in ways not listed here.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+func (s Sharing) Shared() bool {
+	return s.Public || len(s.Accounts) > 0 || len(s.Organizations) > 0
+}
+
+func (s Sharing) String() string {
+	var parts []string
+	if s.Public {
+		parts = append(parts, "public")
+	}
+	if len(s.Accounts) > 0 {
+		parts = append(parts, "accounts "+strings.Join(s.Accounts, ","))
+	}
+	if len(s.Organizations) > 0 {
+		parts = append(parts, "organizations "+strings.Join(s.Organizations, ","))
+	}
+	if s.Unknown {
+		parts = append(parts, "unknown")
+	}
+	if len(parts) == 0 {
+		return "private"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Shared reports whether ami or any of its snapshots is shared. Sharing must
+// have been fetched with FetchSharing.
+func (a AMI) Shared() bool {
+	if a.LaunchPermission.Shared() {
+		return true
+	}
+	for _, snapshot := range a.Snapshots {
+		if snapshot.CreateVolumePermission.Shared() {
+			return true
+		}
+	}
+	return false
+}
+
+// SharingUnknown reports whether the permissions of ami or any of its
+// snapshots could not be described.
+func (a AMI) SharingUnknown() bool {
+	if a.LaunchPermission.Unknown {
+		return true
+	}
+	for _, snapshot := range a.Snapshots {
+		if snapshot.CreateVolumePermission.Unknown {
+			return true
+		}
+	}
+	return false
+}
+
+// markSharingUnknown flags the image and snapshot permissions of ami as
+// unknown. Public is kept, DescribeImages reported it.
+func markSharingUnknown(ami *AMI) {
+	ami.LaunchPermission = Sharing{Public: ami.Public, Unknown: true}
+	for j := range ami.Snapshots {
+		ami.Snapshots[j].CreateVolumePermission = Sharing{Unknown: true}
+	}
+}
+
+// FetchSharing fills in the launch permissions of amis and the create volume
+// permissions of their snapshots, all of which must be in region. Permissions
+// that cannot be described, for example of an image deregistered meanwhile,
+// are marked Unknown and the other images are still fetched. A cancelled ctx
+// marks the images not fetched yet Unknown and is returned.
+func FetchSharing(ctx context.Context, client *ec2.Client, region string, amis []AMI) error {
+	for i := range amis {
+		if err := ctx.Err(); err != nil {
+			for k := i; k < len(amis); k++ {
+				markSharingUnknown(&amis[k])
+			}
+			return err
+		}
+
+		ami := &amis[i]
+
+		start := time.Now()
+		callCtx, cancel := ec2client.CallContext(ctx)
+		image, err := client.DescribeImageAttribute(callCtx, &ec2.DescribeImageAttributeInput{
+			ImageId:   aws.String(ami.ID),
+			Attribute: types.ImageAttributeNameLaunchPermission,
+		})
+		cancel()
+		if err != nil {
+			slog.Warn("error describing launch permissions, sharing unknown", "region", region, "ami_id", ami.ID, "action", "DescribeImageAttribute", "error", err)
+			markSharingUnknown(ami)
+			continue
+		}
+
+		slog.Debug("described image attribute", "region", region, "ami_id", ami.ID, "action", "DescribeImageAttribute", "duration_ms", time.Since(start).Milliseconds())
+
+		ami.LaunchPermission = launchSharing(image.LaunchPermissions)
+
+		for j := range ami.Snapshots {
+			snapshot := &ami.Snapshots[j]
+
+			start := time.Now()
+			callCtx, cancel := ec2client.CallContext(ctx)
+			attr, err := client.DescribeSnapshotAttribute(callCtx, &ec2.DescribeSnapshotAttributeInput{
+				SnapshotId: aws.String(snapshot.ID),
+				Attribute:  types.SnapshotAttributeNameCreateVolumePermission,
+			})
+			cancel()
+			if err != nil {
+				slog.Warn("error describing create volume permissions, sharing unknown", "region", region, "ami_id", ami.ID, "snapshot_id", snapshot.ID, "action", "DescribeSnapshotAttribute", "error", err)
+				snapshot.CreateVolumePermission = Sharing{Unknown: true}
+				continue
+			}
+
+			slog.Debug("described snapshot attribute", "region", region, "snapshot_id", snapshot.ID, "action", "DescribeSnapshotAttribute", "duration_ms", time.Since(start).Milliseconds())
+
+			snapshot.CreateVolumePermission = volumeSharing(attr.CreateVolumePermissions)
+		}
+	}
+
+	return nil
+}
+
+// FetchSharingAllRegions runs FetchSharing for amis from any region, a few
+// regions at a time. AMIs in a region without a client, or not reached
+// before ctx was cancelled, have their sharing marked Unknown.
+func FetchSharingAllRegions(ctx context.Context, amis []AMI) {
+	byRegion := make(map[string][]int)
+	for i, ami := range amis {
+		byRegion[ami.Region] = append(byRegion[ami.Region], i)
+	}
+
+	sem := semaphore.NewWeighted(maxConcurrentRequests)
+	var g errgroup.Group
+
+	// Every region writes back only its own indexes of amis, so the writes
+	// need no lock.
+	for region, indexes := range byRegion {
+		region, indexes := region, indexes
+		if err := sem.Acquire(ctx, 1); err != nil {
+			for _, i := range indexes {
+				markSharingUnknown(&amis[i])
+			}
+			continue
+		}
+
+		g.Go(func() error {
+			defer sem.Release(1)
+
+			client, err := ec2client.New(ctx, region)
+			if err != nil {
+				slog.Error("error loading config", "region", region, "error", err)
+				for _, i := range indexes {
+					markSharingUnknown(&amis[i])
+				}
+				return nil
+			}
+
+			regional := make([]AMI, 0, len(indexes))
+			for _, i := range indexes {
+				regional = append(regional, amis[i])
+			}
+
+			if err := FetchSharing(ctx, client, region, regional); err != nil {
+				slog.Error("error fetching sharing", "region", region, "error", err)
+			}
+
+			for k, i := range indexes {
+				amis[i] = regional[k]
+			}
+
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+}
+
+func launchSharing(permissions []types.LaunchPermission) Sharing {
+	var s Sharing
+	for _, p := range permissions {
+		switch {
+		case p.Group == types.PermissionGroupAll:
+			s.Public = true
+		case p.UserId != nil:
+			s.Accounts = append(s.Accounts, aws.ToString(p.UserId))
+		case p.OrganizationArn != nil:
+			s.Organizations = append(s.Organizations, aws.ToString(p.OrganizationArn))
+		case p.OrganizationalUnitArn != nil:
+			s.Organizations = append(s.Organizations, aws.ToString(p.OrganizationalUnitArn))
+		}
+	}
+	return s
+}
+
+func volumeSharing(permissions []types.CreateVolumePermission) Sharing {
+	var s Sharing
+	for _, p := range permissions {
+		switch {
+		case p.Group == types.PermissionGroupAll:
+			s.Public = true
+		case p.UserId != nil:
+			s.Accounts = append(s.Accounts, aws.ToString(p.UserId))
+		}
+	}
+	return s
+}
+
+// RevokeSharing removes every launch permission from ami and every create
+// volume permission from its snapshots, as last fetched by FetchSharing.
+func RevokeSharing(ctx context.Context, client *ec2.Client, ami AMI) error {
+	if ami.LaunchPermission.Shared() {
+		var remove []types.LaunchPermission
+		if ami.LaunchPermission.Public {
+			remove = append(remove, types.LaunchPermission{Group: types.PermissionGroupAll})
+		}
+		for _, account := range ami.LaunchPermission.Accounts {
+			remove = append(remove, types.LaunchPermission{UserId: aws.String(account)})
+		}
+		for _, arn := range ami.LaunchPermission.Organizations {
+			if strings.Contains(arn, ":ou/") {
+				remove = append(remove, types.LaunchPermission{OrganizationalUnitArn: aws.String(arn)})
+				continue
+			}
+			remove = append(remove, types.LaunchPermission{OrganizationArn: aws.String(arn)})
+		}
+
+		callCtx, cancel := ec2client.CallContext(ctx)
+		_, err := client.ModifyImageAttribute(callCtx, &ec2.ModifyImageAttributeInput{
+			ImageId:          aws.String(ami.ID),
+			LaunchPermission: &types.LaunchPermissionModifications{Remove: remove},
+		})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error revoking launch permissions of %s: %w", ami.ID, err)
+		}
+
+		slog.Info("revoked launch permissions", "region", ami.Region, "ami_id", ami.ID, "sharing", ami.LaunchPermission.String())
+	}
+
+	for _, snapshot := range ami.Snapshots {
+		if !snapshot.CreateVolumePermission.Shared() {
+			continue
+		}
+
+		var remove []types.CreateVolumePermission
+		if snapshot.CreateVolumePermission.Public {
+			remove = append(remove, types.CreateVolumePermission{Group: types.PermissionGroupAll})
+		}
+		for _, account := range snapshot.CreateVolumePermission.Accounts {
+			remove = append(remove, types.CreateVolumePermission{UserId: aws.String(account)})
+		}
+
+		callCtx, cancel := ec2client.CallContext(ctx)
+		_, err := client.ModifySnapshotAttribute(callCtx, &ec2.ModifySnapshotAttributeInput{
+			SnapshotId:             aws.String(snapshot.ID),
+			CreateVolumePermission: &types.CreateVolumePermissionModifications{Remove: remove},
+		})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error revoking create volume permissions of %s: %w", snapshot.ID, err)
+		}
+
+		slog.Info("revoked create volume permissions", "region", ami.Region, "ami_id", ami.ID, "snapshot_id", snapshot.ID, "sharing", snapshot.CreateVolumePermission.String())
+	}
+
+	return nil
+}
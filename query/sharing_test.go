@@ -0,0 +1,101 @@
+package query
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"github.com/gkwa/fragiledonkey/ec2stub"
+)
+
+func TestFetchSharingAgainstStub(t *testing.T) {
+	ec2stub.Start(t, `
+images:
+  - id: ami-shared
+    name: northflier-2026-08-01-a
+    region: us-west-2
+    creation_date: 2026-08-01T00:00:00Z
+    launch_permissions: [{user_id: "210987654321"}]
+    snapshots: [snap-shared]
+  - {id: ami-private, name: northflier-2026-08-02-a, region: us-west-2, creation_date: 2026-08-02T00:00:00Z}
+snapshots:
+  - id: snap-shared
+    region: us-west-2
+    description: Created by CreateImage(i-0) for ami-shared
+    create_volume_permissions: [{group: all}]
+`)
+
+	ctx := context.Background()
+
+	client, err := ec2client.New(ctx, "us-west-2")
+	if err != nil {
+		t.Fatalf("ec2client.New() error = %v", err)
+	}
+
+	// ami-gone was deregistered after the query listed it.
+	amis := []AMI{
+		{ID: "ami-gone", Region: "us-west-2", Public: true, Snapshots: []Snapshot{{ID: "snap-gone"}}},
+		{ID: "ami-shared", Region: "us-west-2", Snapshots: []Snapshot{{ID: "snap-shared"}}},
+		{ID: "ami-private", Region: "us-west-2"},
+	}
+
+	if err := FetchSharing(ctx, client, "us-west-2", amis); err != nil {
+		t.Fatalf("FetchSharing() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		got      Sharing
+		expected Sharing
+	}{
+		{name: "gone image", got: amis[0].LaunchPermission, expected: Sharing{Public: true, Unknown: true}},
+		{name: "gone snapshot", got: amis[0].Snapshots[0].CreateVolumePermission, expected: Sharing{Unknown: true}},
+		{name: "shared image", got: amis[1].LaunchPermission, expected: Sharing{Accounts: []string{"210987654321"}}},
+		{name: "shared snapshot", got: amis[1].Snapshots[0].CreateVolumePermission, expected: Sharing{Public: true}},
+		{name: "private image", got: amis[2].LaunchPermission, expected: Sharing{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.expected) {
+				t.Errorf("sharing = %+v, want %+v", tt.got, tt.expected)
+			}
+		})
+	}
+
+	if !amis[0].SharingUnknown() || amis[1].SharingUnknown() {
+		t.Errorf("SharingUnknown() = %v, %v, want true, false", amis[0].SharingUnknown(), amis[1].SharingUnknown())
+	}
+}
+
+func TestFetchSharingAllRegionsAgainstStub(t *testing.T) {
+	ec2stub.Start(t, `
+images:
+  - {id: ami-west, name: northflier-2026-08-01-a, region: us-west-2, creation_date: 2026-08-01T00:00:00Z, public: true}
+  - {id: ami-eu, name: northflier-2026-08-01-a, region: eu-central-1, creation_date: 2026-08-01T00:00:00Z, launch_permissions: [{user_id: "210987654321"}]}
+  - {id: ami-east, name: northflier-2026-08-02-a, region: us-east-1, creation_date: 2026-08-02T00:00:00Z}
+denied:
+  us-east-1: [DescribeImageAttribute]
+`)
+
+	amis := []AMI{
+		{ID: "ami-west", Region: "us-west-2"},
+		{ID: "ami-eu", Region: "eu-central-1"},
+		{ID: "ami-east", Region: "us-east-1"},
+	}
+
+	FetchSharingAllRegions(context.Background(), amis)
+
+	expected := []Sharing{
+		{Public: true},
+		{Accounts: []string{"210987654321"}},
+		{Unknown: true},
+	}
+
+	for i, ami := range amis {
+		if !reflect.DeepEqual(ami.LaunchPermission, expected[i]) {
+			t.Errorf("%s sharing = %+v, want %+v", ami.ID, ami.LaunchPermission, expected[i])
+		}
+	}
+}
@@ -0,0 +1,448 @@
+// Package replicate keeps copies of the newest images of a family in a set
+// of target regions.
+package replicate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"github.com/gkwa/fragiledonkey/inventory"
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/errgroup"
+)
+
+// Tags written on every copy. SourceAMITag is how later runs recognise an
+// image that was already copied, whatever its name.
+const (
+	SourceAMITag    = "fragiledonkey:source-ami"
+	SourceRegionTag = "fragiledonkey:source-region"
+)
+
+type Options struct {
+	Filter       query.Filter
+	SourceRegion string
+	Targets      []string
+	// Count is how many of the newest matched images in SourceRegion must
+	// exist in every target region.
+	Count int
+	// KMSKeyID re-encrypts the copies with this key. KMSKeys overrides it per
+	// target region, since keys are regional.
+	KMSKeyID string
+	KMSKeys  map[string]string
+	// PlanOnly prints what would be copied and stops.
+	PlanOnly bool
+	// Inventory, when set, is planned against instead of querying EC2. It
+	// requires PlanOnly.
+	Inventory *inventory.Inventory
+}
+
+// ConfiguredKMSKeys returns the per-region keys under replicate.kms-keys in
+// the config file.
+func ConfiguredKMSKeys() map[string]string {
+	return viper.GetStringMapString("replicate.kms-keys")
+}
+
+// Validate checks that opts names a source, targets and a count.
+func (o Options) Validate() error {
+	if o.SourceRegion == "" {
+		return errors.New("--source-region must be provided")
+	}
+	if len(o.Targets) == 0 {
+		return errors.New("--target-region or replicate.targets must name at least one region")
+	}
+	if o.Count < 1 {
+		return errors.New("--count must be at least 1")
+	}
+	if o.Inventory != nil && !o.PlanOnly {
+		return errors.New("a replication from an inventory file can only print its plan")
+	}
+	return nil
+}
+
+func (o Options) kmsKey(region string) string {
+	if key := o.KMSKeys[region]; key != "" {
+		return key
+	}
+	return o.KMSKeyID
+}
+
+// targets returns the target regions without the source region, which needs
+// no copy.
+func (o Options) targets() []string {
+	var targets []string
+	for _, region := range o.Targets {
+		if region == o.SourceRegion {
+			slog.Warn("skipping target region, it is the source region", "region", region)
+			continue
+		}
+		if !slices.Contains(targets, region) {
+			targets = append(targets, region)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Copy is one source image in one target region.
+type Copy struct {
+	Source query.AMI
+	Region string
+	// ImageID is the copy in Region. It is set for copies that already
+	// existed and for the ones made by this run.
+	ImageID string
+	// Existing is true when the copy was found rather than made.
+	Existing bool
+	Err      error
+}
+
+// newest returns the count newest available images among amis.
+func newest(amis []query.AMI, count int) []query.AMI {
+	var available []query.AMI
+	for _, ami := range amis {
+		if ami.State == string(types.ImageStateAvailable) {
+			available = append(available, ami)
+		}
+	}
+
+	sort.Slice(available, func(i, j int) bool {
+		return available[i].CreationDate.After(available[j].CreationDate)
+	})
+
+	if len(available) > count {
+		available = available[:count]
+	}
+
+	return available
+}
+
+// plan returns a Copy for every source image in every target region. copies
+// are the images found in the target regions; any carrying SourceAMITag for a
+// source image counts as its copy.
+func plan(sources, copies []query.AMI, targets []string) []Copy {
+	existing := make(map[string]string)
+	for _, ami := range copies {
+		if query.IsBrokenState(ami.State) {
+			continue
+		}
+		if source := ami.Tags[SourceAMITag]; source != "" {
+			existing[ami.Region+"/"+source] = ami.ID
+		}
+	}
+
+	var planned []Copy
+
+	for _, region := range targets {
+		for _, source := range sources {
+			c := Copy{Source: source, Region: region}
+			if id, ok := existing[region+"/"+source.ID]; ok {
+				c.ImageID = id
+				c.Existing = true
+			}
+			planned = append(planned, c)
+		}
+	}
+
+	return planned
+}
+
+// RunReplicate runs Replicate and prints the result. It fails when
+// replication could not run or any copy failed.
+func RunReplicate(ctx context.Context, opts Options) error {
+	copies, err := Replicate(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("error during replication: %w", err)
+	}
+
+	Print(copies, opts.PlanOnly)
+
+	failed := 0
+	for _, c := range copies {
+		if c.Err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d copies failed", failed, len(copies))
+	}
+
+	return nil
+}
+
+// Replicate copies the newest opts.Count images from the source region to
+// every target region that lacks them. With PlanOnly nothing is copied.
+func Replicate(ctx context.Context, opts Options) ([]Copy, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	targets := opts.targets()
+
+	if opts.Inventory != nil {
+		return planInventory(opts.Inventory, opts, targets), nil
+	}
+
+	sourceClient, err := ec2client.New(ctx, opts.SourceRegion)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config for %s: %w", opts.SourceRegion, err)
+	}
+
+	sources := newest(query.QueryAMIs(ctx, sourceClient, opts.Filter, opts.SourceRegion), opts.Count)
+	if len(sources) == 0 {
+		slog.Warn("no images to replicate", "region", opts.SourceRegion, "filter", opts.Filter.String())
+		return nil, nil
+	}
+
+	attempt := newAttempt()
+
+	var g errgroup.Group
+
+	var mu sync.Mutex
+
+	var copies []Copy
+
+	for _, region := range targets {
+		region := region
+
+		g.Go(func() error {
+			client, err := ec2client.New(ctx, region)
+			if err != nil {
+				slog.Error("error loading config", "region", region, "error", err)
+				return err
+			}
+
+			found, err := findCopies(ctx, client, region, sources)
+			if err != nil {
+				slog.Error("error looking for existing copies, skipping region", "region", region, "error", err)
+				return nil
+			}
+
+			planned := plan(sources, found, []string{region})
+
+			if !opts.PlanOnly {
+				for i := range planned {
+					if planned[i].Existing || ctx.Err() != nil {
+						continue
+					}
+					planned[i].ImageID, planned[i].Err = copyImage(ctx, client, planned[i], opts, attempt)
+				}
+			}
+
+			mu.Lock()
+			copies = append(copies, planned...)
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		slog.Error("error during replication", "error", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return copies, err
+	}
+
+	sortCopies(copies)
+
+	return copies, nil
+}
+
+// planInventory plans against a saved inventory, which must hold the source
+// and target regions.
+func planInventory(inv *inventory.Inventory, opts Options, targets []string) []Copy {
+	var sources, found []query.AMI
+
+	for _, ami := range inv.AMIs {
+		switch {
+		case ami.Region == opts.SourceRegion && opts.Filter.Matches(ami):
+			sources = append(sources, ami)
+		case slices.Contains(targets, ami.Region):
+			found = append(found, ami)
+		}
+	}
+
+	slog.Warn("planning from an inventory file, copies still pending are only seen if it was saved with --state all", "captured_at", inv.CapturedAt)
+
+	for _, region := range append([]string{opts.SourceRegion}, targets...) {
+		if err, ok := inv.FailedRegions[region]; ok {
+			slog.Warn("inventory is missing the AMIs of a region that failed to query", "region", region, "error", err)
+		}
+	}
+
+	copies := plan(newest(sources, opts.Count), found, targets)
+	sortCopies(copies)
+
+	return copies
+}
+
+func sortCopies(copies []Copy) {
+	sort.SliceStable(copies, func(i, j int) bool {
+		if copies[i].Region != copies[j].Region {
+			return copies[i].Region < copies[j].Region
+		}
+		return copies[i].Source.CreationDate.After(copies[j].Source.CreationDate)
+	})
+}
+
+// findCopies returns the images in region tagged as a copy of any of
+// sources, in every state but deregistered.
+func findCopies(ctx context.Context, client *ec2.Client, region string, sources []query.AMI) ([]query.AMI, error) {
+	ids := make([]string, 0, len(sources))
+	for _, source := range sources {
+		ids = append(ids, source.ID)
+	}
+
+	input := &ec2.DescribeImagesInput{
+		Filters: []types.Filter{{Name: aws.String("tag:" + SourceAMITag), Values: ids}},
+		Owners:  []string{"self"},
+	}
+
+	start := time.Now()
+	callCtx, cancel := ec2client.CallContext(ctx)
+	result, err := client.DescribeImages(callCtx, input)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("described copies", "region", region, "action", "DescribeImages", "count", len(result.Images), "duration_ms", time.Since(start).Milliseconds())
+
+	var found []query.AMI
+
+	for _, image := range result.Images {
+		ami := query.AMI{
+			ID:     aws.ToString(image.ImageId),
+			Name:   aws.ToString(image.Name),
+			State:  string(image.State),
+			Region: region,
+			Tags:   make(map[string]string),
+		}
+		for _, tag := range image.Tags {
+			ami.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		found = append(found, ami)
+	}
+
+	return found, nil
+}
+
+// copyTags returns the source image's tags, without the ones AWS reserves,
+// plus the tags that mark the copy.
+func copyTags(source query.AMI) []types.Tag {
+	keys := make([]string, 0, len(source.Tags))
+	for k := range source.Tags {
+		if strings.HasPrefix(k, "aws:") || k == SourceAMITag || k == SourceRegionTag {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tags := make([]types.Tag, 0, len(keys)+2)
+	for _, k := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(k), Value: aws.String(source.Tags[k])})
+	}
+
+	return append(tags,
+		types.Tag{Key: aws.String(SourceAMITag), Value: aws.String(source.ID)},
+		types.Tag{Key: aws.String(SourceRegionTag), Value: aws.String(source.Region)},
+	)
+}
+
+// newAttempt returns a random id distinguishing the copies requested by one
+// Replicate call from those of earlier runs.
+func newAttempt() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// clientToken makes a retried CopyImage request within one attempt return
+// the copy already started. EC2 answers a reused token with the image it made
+// the first time, even if that copy has since failed or been deregistered, so
+// the token must not carry over to later runs; those find earlier copies by
+// SourceAMITag instead.
+func clientToken(attempt string, c Copy) string {
+	return fmt.Sprintf("fragiledonkey-%s-%s-%s", attempt, c.Source.ID, c.Region)
+}
+
+// copyImage starts the copy of c.Source into c.Region.
+func copyImage(ctx context.Context, client *ec2.Client, c Copy, opts Options, attempt string) (string, error) {
+	tags := copyTags(c.Source)
+
+	input := &ec2.CopyImageInput{
+		Name:          aws.String(c.Source.Name),
+		SourceImageId: aws.String(c.Source.ID),
+		SourceRegion:  aws.String(c.Source.Region),
+		Description:   aws.String(fmt.Sprintf("Copy of %s from %s", c.Source.ID, c.Source.Region)),
+		ClientToken:   aws.String(clientToken(attempt, c)),
+		TagSpecifications: []types.TagSpecification{
+			{ResourceType: types.ResourceTypeImage, Tags: tags},
+			{ResourceType: types.ResourceTypeSnapshot, Tags: tags},
+		},
+	}
+
+	if key := opts.kmsKey(c.Region); key != "" {
+		input.Encrypted = aws.Bool(true)
+		input.KmsKeyId = aws.String(key)
+	}
+
+	start := time.Now()
+	callCtx, cancel := ec2client.CallContext(context.WithoutCancel(ctx))
+	result, err := client.CopyImage(callCtx, input)
+	cancel()
+	if err != nil {
+		slog.Error("error copying image", "region", c.Region, "ami_id", c.Source.ID, "action", "CopyImage", "error", err)
+		return "", err
+	}
+
+	id := aws.ToString(result.ImageId)
+
+	slog.Info("copying image", "region", c.Region, "ami_id", c.Source.ID, "copy_id", id, "name", c.Source.Name, "duration_ms", time.Since(start).Milliseconds())
+
+	return id, nil
+}
+
+// Print lists every copy per target region.
+func Print(copies []Copy, planOnly bool) {
+	region := ""
+
+	for _, c := range copies {
+		if c.Region != region {
+			region = c.Region
+			fmt.Printf("%s:\n", region)
+		}
+
+		var status string
+		switch {
+		case c.Existing:
+			status = "present " + c.ImageID
+		case c.Err != nil:
+			status = "failed"
+		case planOnly:
+			status = "to copy"
+		case c.ImageID == "":
+			status = "skipped"
+		default:
+			status = "copying " + c.ImageID
+		}
+
+		fmt.Printf("- %-21s %-29s %s\n", c.Source.ID, status, c.Source.Name)
+	}
+}
@@ -0,0 +1,169 @@
+package replicate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/ec2stub"
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+func TestPlan(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	amis := []query.AMI{
+		{ID: "ami-1", Region: "us-west-2", State: "available", CreationDate: now.Add(-3 * day)},
+		{ID: "ami-2", Region: "us-west-2", State: "available", CreationDate: now.Add(-2 * day)},
+		{ID: "ami-3", Region: "us-west-2", State: "pending", CreationDate: now.Add(-1 * day)},
+		{ID: "ami-4", Region: "us-west-2", State: "available", CreationDate: now},
+	}
+
+	sources := newest(amis, 2)
+
+	copies := []query.AMI{
+		{ID: "ami-eu4", Region: "eu-central-1", State: "pending", Tags: map[string]string{SourceAMITag: "ami-4"}},
+		{ID: "ami-eu2", Region: "eu-central-1", State: "failed", Tags: map[string]string{SourceAMITag: "ami-2"}},
+		{ID: "ami-us2", Region: "us-east-1", State: "available", Tags: map[string]string{SourceAMITag: "ami-2"}},
+		{ID: "ami-other", Region: "us-east-1", State: "available"},
+	}
+
+	var got []string
+	for _, c := range plan(sources, copies, []string{"eu-central-1", "us-east-1"}) {
+		got = append(got, c.Region+" "+c.Source.ID+" "+c.ImageID)
+	}
+
+	expected := []string{
+		"eu-central-1 ami-4 ami-eu4",
+		"eu-central-1 ami-2 ",
+		"us-east-1 ami-4 ",
+		"us-east-1 ami-2 ami-us2",
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("plan() = %q, want %q", got, expected)
+	}
+}
+
+func TestReplicateAgainstStub(t *testing.T) {
+	stub := ec2stub.Start(t, `
+regions: [us-west-2, eu-central-1, us-east-1]
+images:
+  - {id: ami-1, name: northflier-2026-09-01-a, region: us-west-2, creation_date: 2026-09-01T00:00:00Z}
+  - {id: ami-2, name: northflier-2026-09-15-a, region: us-west-2, creation_date: 2026-09-15T00:00:00Z, snapshots: [snap-2], tags: {Team: build}}
+  - {id: ami-3, name: northflier-2026-09-30-a, region: us-west-2, creation_date: 2026-09-30T00:00:00Z}
+  - id: ami-eu3
+    name: northflier-2026-09-30-a
+    region: eu-central-1
+    creation_date: 2026-09-30T01:00:00Z
+    tags: {"fragiledonkey:source-ami": ami-3}
+snapshots:
+  - {id: snap-2, region: us-west-2, description: Created by CreateImage(i-0) for ami-2, volume_size: 8}
+`)
+
+	opts := Options{
+		Filter:       query.Filter{Patterns: []string{"northflier-*"}, States: []string{"available"}},
+		SourceRegion: "us-west-2",
+		Targets:      []string{"us-east-1", "eu-central-1", "us-west-2"},
+		Count:        2,
+		KMSKeyID:     "alias/ami",
+		KMSKeys:      map[string]string{"eu-central-1": "alias/ami-eu"},
+	}
+
+	copies, err := Replicate(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Replicate() error = %v", err)
+	}
+
+	made := 0
+	for _, c := range copies {
+		if c.Err != nil {
+			t.Errorf("copy of %s to %s error = %v", c.Source.ID, c.Region, c.Err)
+		}
+		if !c.Existing {
+			made++
+		}
+	}
+
+	if len(copies) != 4 || made != 3 {
+		t.Fatalf("Replicate() made %d of %d copies, want 3 of 4", made, len(copies))
+	}
+
+	eu := stub.Images("eu-central-1")
+	if len(eu) != 2 {
+		t.Fatalf("eu-central-1 images = %v, want 2", eu)
+	}
+
+	copied := eu[1]
+	if copied.Name != "northflier-2026-09-15-a" || copied.Tags["Team"] != "build" || copied.Tags[SourceAMITag] != "ami-2" || copied.Tags[SourceRegionTag] != "us-west-2" {
+		t.Errorf("copy = %+v, want ami-2's name and tags plus the source tags", copied)
+	}
+
+	if !copied.Encrypted || copied.KMSKeyID != "alias/ami-eu" {
+		t.Errorf("copy encrypted = %v with %q, want alias/ami-eu", copied.Encrypted, copied.KMSKeyID)
+	}
+
+	if len(copied.Snapshots) != 1 || len(stub.Snapshots("eu-central-1")) != 1 {
+		t.Errorf("copy snapshots = %v, want one copied snapshot", copied.Snapshots)
+	}
+
+	if us := stub.Images("us-east-1"); len(us) != 2 || us[0].KMSKeyID != "alias/ami" {
+		t.Errorf("us-east-1 images = %v, want 2 encrypted with alias/ami", us)
+	}
+
+	// A second run finds every copy and makes none.
+	copies, err = Replicate(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("second Replicate() error = %v", err)
+	}
+
+	for _, c := range copies {
+		if !c.Existing {
+			t.Errorf("second run copied %s to %s again", c.Source.ID, c.Region)
+		}
+	}
+}
+
+func TestReplicateRetriesFailedCopy(t *testing.T) {
+	stub := ec2stub.Start(t, `
+regions: [us-west-2, eu-central-1]
+images:
+  - {id: ami-1, name: northflier-2026-09-01-a, region: us-west-2, creation_date: 2026-09-01T00:00:00Z}
+`)
+
+	opts := Options{
+		Filter:       query.Filter{Patterns: []string{"northflier-*"}, States: []string{"available"}},
+		SourceRegion: "us-west-2",
+		Targets:      []string{"eu-central-1"},
+		Count:        1,
+	}
+
+	copies, err := Replicate(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Replicate() error = %v", err)
+	}
+
+	if len(copies) != 1 || copies[0].ImageID == "" {
+		t.Fatalf("Replicate() = %+v, want one copy", copies)
+	}
+
+	failed := copies[0].ImageID
+	stub.SetImageState("eu-central-1", failed, "failed")
+
+	// The failed copy counts as missing, and the retry must make a new one
+	// rather than get the failed image back for a reused client token.
+	copies, err = Replicate(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("second Replicate() error = %v", err)
+	}
+
+	if len(copies) != 1 || copies[0].Existing || copies[0].ImageID == "" || copies[0].ImageID == failed {
+		t.Fatalf("second Replicate() = %+v, want a new copy replacing %s", copies, failed)
+	}
+
+	if eu := stub.Images("eu-central-1"); len(eu) != 2 || eu[1].State != "available" {
+		t.Errorf("eu-central-1 images = %+v, want the failed copy and a new available one", eu)
+	}
+}
@@ -0,0 +1,247 @@
+// Package security checks that no matched AMI is public and that block
+// public access for images and snapshots is turned on in every region.
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/gkwa/fragiledonkey/ec2client"
+	"github.com/gkwa/fragiledonkey/query"
+	"golang.org/x/sync/errgroup"
+)
+
+type Options struct {
+	Filter query.Filter
+	// RequireBlockPublicAccess makes unblocked image or snapshot block public
+	// access in any region a violation.
+	RequireBlockPublicAccess bool
+}
+
+// RegionState is the block public access state of a region. Err is set when
+// it could not be read.
+type RegionState struct {
+	Region   string `json:"region"`
+	Image    string `json:"image_block_public_access"`
+	Snapshot string `json:"snapshot_block_public_access"`
+	Err      string `json:"error,omitempty"`
+}
+
+type Violation struct {
+	Region   string `json:"region"`
+	Resource string `json:"resource,omitempty"`
+	Problem  string `json:"problem"`
+}
+
+type Report struct {
+	PublicAMIs []query.AMI   `json:"public_amis"`
+	Regions    []RegionState `json:"regions"`
+	Violations []Violation   `json:"violations"`
+}
+
+// Check queries the matched AMIs and the block public access state of every
+// region enabled for the account and evaluates them.
+func Check(ctx context.Context, opts Options) (Report, error) {
+	listing, err := query.QueryAMIsEachRegion(ctx, opts.Filter)
+	if err != nil {
+		return Report{}, err
+	}
+
+	// Regions the account has not opted in to reject every call, so they are
+	// neither listed nor checked. Credentials rejected everywhere would pass
+	// the check without looking at anything.
+	regions := listing.EnabledRegions()
+	if len(regions) == 0 && len(listing.Regions) > 0 {
+		return Report{}, fmt.Errorf("none of %d regions accepted the credentials", len(listing.Regions))
+	}
+
+	var states []RegionState
+	if opts.RequireBlockPublicAccess {
+		states, err = regionStates(ctx, regions)
+		if err != nil {
+			return Report{}, err
+		}
+	}
+
+	return evaluate(listing.AMIs, listing.Failed, states), nil
+}
+
+// evaluate lists the public AMIs and turns them, every region whose AMIs
+// could not be listed and every region not blocking public access into
+// violations. A region whose state is unknown is a violation too, so a
+// pipeline gated on the report fails closed.
+func evaluate(amis []query.AMI, queryErrs map[string]error, states []RegionState) Report {
+	// A clean report has "public_amis": [] and "violations": [], which is
+	// what a pipeline gated on it should compare against, not null.
+	r := Report{PublicAMIs: []query.AMI{}, Regions: states, Violations: []Violation{}}
+	if r.Regions == nil {
+		r.Regions = []RegionState{}
+	}
+
+	for _, ami := range amis {
+		if ami.Public {
+			r.PublicAMIs = append(r.PublicAMIs, ami)
+		}
+	}
+
+	sort.Slice(r.PublicAMIs, func(i, j int) bool {
+		if r.PublicAMIs[i].Region != r.PublicAMIs[j].Region {
+			return r.PublicAMIs[i].Region < r.PublicAMIs[j].Region
+		}
+		return r.PublicAMIs[i].Name < r.PublicAMIs[j].Name
+	})
+
+	for _, ami := range r.PublicAMIs {
+		r.Violations = append(r.Violations, Violation{Region: ami.Region, Resource: ami.ID, Problem: fmt.Sprintf("AMI %s is public", ami.Name)})
+	}
+
+	regions := make([]string, 0, len(queryErrs))
+	for region := range queryErrs {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	for _, region := range regions {
+		r.Violations = append(r.Violations, Violation{Region: region, Problem: "AMIs could not be listed: " + queryErrs[region].Error()})
+	}
+
+	for _, s := range states {
+		if s.Err != "" {
+			r.Violations = append(r.Violations, Violation{Region: s.Region, Problem: "block public access could not be checked: " + s.Err})
+			continue
+		}
+
+		if s.Image != string(types.ImageBlockPublicAccessEnabledStateBlockNewSharing) {
+			r.Violations = append(r.Violations, Violation{Region: s.Region, Problem: "image block public access is " + s.Image})
+		}
+
+		if s.Snapshot != string(types.SnapshotBlockPublicAccessStateBlockAllSharing) && s.Snapshot != string(types.SnapshotBlockPublicAccessStateBlockNewSharing) {
+			r.Violations = append(r.Violations, Violation{Region: s.Region, Problem: "snapshot block public access is " + s.Snapshot})
+		}
+	}
+
+	return r
+}
+
+// regionStates reads the image and snapshot block public access state of
+// every region concurrently.
+func regionStates(ctx context.Context, regions []string) ([]RegionState, error) {
+	var g errgroup.Group
+
+	var mu sync.Mutex
+
+	var states []RegionState
+
+	for _, region := range regions {
+		region := region
+
+		g.Go(func() error {
+			client, err := ec2client.New(ctx, region)
+			if err != nil {
+				slog.Error("error loading config", "region", region, "error", err)
+				return err
+			}
+
+			state := regionState(ctx, client, region)
+
+			mu.Lock()
+			states = append(states, state)
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].Region < states[j].Region })
+
+	return states, nil
+}
+
+func regionState(ctx context.Context, client *ec2.Client, region string) RegionState {
+	state := RegionState{Region: region}
+
+	start := time.Now()
+	callCtx, cancel := ec2client.CallContext(ctx)
+	image, err := client.GetImageBlockPublicAccessState(callCtx, &ec2.GetImageBlockPublicAccessStateInput{})
+	cancel()
+	if err != nil {
+		slog.Error("error getting image block public access state", "region", region, "action", "GetImageBlockPublicAccessState", "error", err)
+		state.Err = err.Error()
+		return state
+	}
+
+	slog.Debug("got image block public access state", "region", region, "action", "GetImageBlockPublicAccessState", "duration_ms", time.Since(start).Milliseconds())
+
+	state.Image = aws.ToString(image.ImageBlockPublicAccessState)
+
+	start = time.Now()
+	callCtx, cancel = ec2client.CallContext(ctx)
+	snapshot, err := client.GetSnapshotBlockPublicAccessState(callCtx, &ec2.GetSnapshotBlockPublicAccessStateInput{})
+	cancel()
+	if err != nil {
+		slog.Error("error getting snapshot block public access state", "region", region, "action", "GetSnapshotBlockPublicAccessState", "error", err)
+		state.Err = err.Error()
+		return state
+	}
+
+	slog.Debug("got snapshot block public access state", "region", region, "action", "GetSnapshotBlockPublicAccessState", "duration_ms", time.Since(start).Milliseconds())
+
+	state.Snapshot = string(snapshot.State)
+
+	return state
+}
+
+// Print writes r for people to read.
+func (r Report) Print(w io.Writer) {
+	if len(r.PublicAMIs) > 0 {
+		fmt.Fprintln(w, "Public AMIs:")
+		for _, ami := range r.PublicAMIs {
+			fmt.Fprintf(w, "- %-15s %-21s %s\n", ami.Region, ami.ID, ami.Name)
+		}
+	}
+
+	if len(r.Regions) > 0 {
+		fmt.Fprintln(w, "Block public access:")
+		for _, s := range r.Regions {
+			if s.Err != "" {
+				fmt.Fprintf(w, "- %-15s unknown\n", s.Region)
+				continue
+			}
+			fmt.Fprintf(w, "- %-15s images %-17s snapshots %s\n", s.Region, s.Image, s.Snapshot)
+		}
+	}
+
+	if len(r.Violations) == 0 {
+		fmt.Fprintln(w, "No policy violations")
+		return
+	}
+
+	fmt.Fprintf(w, "Policy violations (%d):\n", len(r.Violations))
+	for _, v := range r.Violations {
+		fmt.Fprintf(w, "- %s: %s\n", v.Region, v.Problem)
+	}
+}
+
+// WriteJSON writes r as indented JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
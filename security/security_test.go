@@ -0,0 +1,124 @@
+package security
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gkwa/fragiledonkey/ec2stub"
+	"github.com/gkwa/fragiledonkey/query"
+)
+
+func TestCheckAgainstStub(t *testing.T) {
+	ec2stub.Start(t, `
+regions: [us-west-2, eu-central-1, us-east-1]
+images:
+  - {id: ami-public, name: northflier-2026-08-01-a, region: us-west-2, creation_date: 2026-08-01T00:00:00Z, public: true}
+  - {id: ami-private, name: northflier-2026-08-02-a, region: us-west-2, creation_date: 2026-08-02T00:00:00Z}
+  - {id: ami-other, name: nginx-2026-08-01-a, region: eu-central-1, creation_date: 2026-08-01T00:00:00Z, public: true}
+block_public_access:
+  us-west-2: {image: block-new-sharing, snapshot: block-all-sharing}
+  eu-central-1: {image: block-new-sharing, snapshot: block-new-sharing}
+  us-east-1: {snapshot: block-all-sharing}
+`, "us-west-2", "eu-central-1", "us-east-1")
+
+	filter := query.Filter{Patterns: []string{"northflier-*"}, States: []string{"all"}}
+
+	tests := []struct {
+		name       string
+		opts       Options
+		violations []Violation
+	}{
+		{
+			name: "with block public access",
+			opts: Options{Filter: filter, RequireBlockPublicAccess: true},
+			violations: []Violation{
+				{Region: "us-west-2", Resource: "ami-public", Problem: "AMI northflier-2026-08-01-a is public"},
+				{Region: "us-east-1", Problem: "image block public access is unblocked"},
+			},
+		},
+		{
+			name: "public AMIs only",
+			opts: Options{Filter: filter},
+			violations: []Violation{
+				{Region: "us-west-2", Resource: "ami-public", Problem: "AMI northflier-2026-08-01-a is public"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Check(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(report.Violations, tt.violations) {
+				t.Errorf("Check() violations = %+v, want %+v", report.Violations, tt.violations)
+			}
+		})
+	}
+}
+
+func TestCheckReportsRegionsThatCannotBeListed(t *testing.T) {
+	ec2stub.Start(t, `
+regions: [us-west-2, eu-central-1]
+images:
+  - {id: ami-public, name: northflier-2026-08-01-a, region: eu-central-1, creation_date: 2026-08-01T00:00:00Z, public: true}
+denied:
+  eu-central-1: [DescribeImages]
+`, "us-west-2", "eu-central-1")
+
+	report, err := Check(context.Background(), Options{Filter: query.Filter{Patterns: []string{"northflier-*"}, States: []string{"all"}}})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	// The public AMI is hidden by the denied call, which must not pass.
+	if len(report.Violations) != 1 || report.Violations[0].Region != "eu-central-1" || !strings.HasPrefix(report.Violations[0].Problem, "AMIs could not be listed: ") {
+		t.Errorf("Check() violations = %+v, want eu-central-1 reported as not listed", report.Violations)
+	}
+}
+
+func TestCheckSkipsRegionsNotOptedIn(t *testing.T) {
+	stub := ec2stub.Start(t, `
+regions: [us-west-2, ap-east-1]
+images:
+  - {id: ami-private, name: northflier-2026-08-01-a, region: us-west-2, creation_date: 2026-08-01T00:00:00Z}
+block_public_access:
+  us-west-2: {image: block-new-sharing, snapshot: block-all-sharing}
+not_opted_in: [ap-east-1]
+`, "us-west-2", "ap-east-1")
+
+	opts := Options{Filter: query.Filter{Patterns: []string{"northflier-*"}, States: []string{"all"}}, RequireBlockPublicAccess: true}
+
+	report, err := Check(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	if !slices.Contains(stub.Calls(), "ap-east-1:DescribeImages") {
+		t.Fatalf("calls = %v, want ap-east-1 queried", stub.Calls())
+	}
+
+	if len(report.Violations) != 0 {
+		t.Errorf("Check() violations = %+v, want none for a region not opted in to", report.Violations)
+	}
+
+	if len(report.Regions) != 1 || report.Regions[0].Region != "us-west-2" {
+		t.Errorf("Check() regions = %+v, want only us-west-2", report.Regions)
+	}
+}
+
+func TestCheckFailsWhenNoRegionAcceptsCredentials(t *testing.T) {
+	ec2stub.Start(t, `
+regions: [us-west-2]
+not_opted_in: [us-west-2]
+`, "us-west-2")
+
+	if _, err := Check(context.Background(), Options{Filter: query.Filter{Patterns: []string{"northflier-*"}, States: []string{"all"}}}); err == nil {
+		t.Error("Check() error = nil, want an error when every region rejects the credentials")
+	}
+}
@@ -0,0 +1,68 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gkwa/fragiledonkey/metrics"
+	"github.com/gkwa/fragiledonkey/query"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Run serves /metrics on addr and refreshes the inventory gauges every
+// interval until ctx is done. It fails when addr cannot be served.
+func Run(ctx context.Context, addr string, filter query.Filter, interval time.Duration) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go refresh(ctx, filter, interval)
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("error shutting down metrics server", "error", err)
+		}
+	}()
+
+	slog.Info("serving metrics", "addr", addr, "interval", interval)
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving metrics on %s: %w", addr, err)
+	}
+
+	return nil
+}
+
+func refresh(ctx context.Context, filter query.Filter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if _, err := query.QueryAMIsAllRegions(ctx, filter); err != nil {
+			slog.Error("error refreshing inventory", "error", err)
+		} else {
+			slog.Info("refreshed inventory", "duration_ms", time.Since(start).Milliseconds())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}